@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -33,7 +32,7 @@ var replacements = map[string]string{
 	"ian": "January",
 }
 
-var _ scraper.Parser[int] = &CampionParser{}
+var _ scraper.PagedParser[int] = &CampionParser{}
 
 const subsPerPage = 14
 const campionFormat = "_2 January 2006, 15:04"
@@ -41,13 +40,16 @@ const campionFormat = "_2 January 2006, 15:04"
 func parseSubmission(node *html.Node) (*scraper.Submission, error) {
 	sel := goquery.NewDocumentFromNode(node)
 	//zap.S().Warn(node.)
+	if len(sel.Children().Nodes) < 8 || sel.Children().Nodes[6].FirstChild == nil {
+		return nil, scraper.ParseError(errors.New("unexpected monitor row"))
+	}
 
 	var sub = new(scraper.Submission)
 	idText := strings.TrimSpace(goquery.NewDocumentFromNode(sel.Children().Nodes[0]).Text())
 	id, err := strconv.Atoi(strings.TrimPrefix(idText, "#"))
 	if err != nil {
-		zap.S().Warn("Invalid ID from ", idText)
-		return nil, err
+		zap.S().Warnw("Invalid submission ID", "id", idText)
+		return nil, scraper.ParseError(err)
 	}
 	sub.ID = id
 	sub.Handled = true
@@ -66,15 +68,15 @@ func parseSubmission(node *html.Node) (*scraper.Submission, error) {
 	}
 	t, err := time.ParseInLocation(campionFormat, date, location)
 	if err != nil {
-		zap.S().Info("Invalid time from campion.edu.ro: ", date)
-		return nil, errors.New("invalid time")
+		zap.S().Infow("Invalid submission time", "date", date, "submission_id", sub.ID)
+		return nil, scraper.ParseError(errors.New("invalid time"))
 	}
 	sub.Date = t
 
 	score := strings.TrimSpace(goquery.NewDocumentFromNode(sel.Children().Nodes[7]).Find("a").First().Text())
 	val, err := strconv.Atoi(score)
 	if err != nil {
-		zap.S().Info(score)
+		zap.S().Infow("Invalid score", "score", score, "submission_id", sub.ID)
 	} else {
 		sub.Score = &val
 	}
@@ -90,18 +92,14 @@ func ParseMonitorPage(ctx context.Context, offset int) ([]*scraper.Submission, e
 		Path:     "arhiva/index.php",
 		RawQuery: fmt.Sprintf("page=sources&action=view&paging=%d", page),
 	}
-	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := scraper.Get(ctx, url.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, scraper.ParseError(err)
 	}
 	sel := doc.Find(".loctabel")
 	var subs = make([]*scraper.Submission, 0, subsPerPage+5)
@@ -117,6 +115,10 @@ func ParseMonitorPage(ctx context.Context, offset int) ([]*scraper.Submission, e
 
 type CampionParser struct{}
 
+func (p *CampionParser) ProblemURL(problemID string) string {
+	return "http://campion.edu.ro/arhiva/index.php?page=problem&action=view&id=" + url.QueryEscape(problemID)
+}
+
 func (p *CampionParser) PageZeroOffset() int {
 	return 0
 }
@@ -129,6 +131,10 @@ func (p *CampionParser) NextPageOffset(t int, subs []*scraper.Submission) int {
 	return t + len(subs)
 }
 
+func (p *CampionParser) PageOffset(start int, n int) int {
+	return start + n*subsPerPage
+}
+
 func (p *CampionParser) GetPage(ctx context.Context, offset int) ([]*scraper.Submission, error) {
 	return ParseMonitorPage(ctx, offset)
 }
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+// Charts holds server-side rendered SVG charts. They need no scripts or external assets,
+// so they can be pasted as-is in the blog body. Empty if charts are disabled or there is no data.
+type Charts struct {
+	// Line chart of daily submission counts, one line per platform
+	DailySubmissions template.HTML
+	// Line chart of distinct users over the trailing 30 days, one line per platform
+	ActiveUsers template.HTML
+	// Bar chart of unique users per calendar month, one bar per platform
+	MonthlyUsers template.HTML
+	// Bar chart of submission counts per rolling interval, one bar per platform
+	RollingSubmissions template.HTML
+}
+
+const (
+	chartWidth   = 800
+	chartHeight  = 300
+	chartPadLeft = 60
+	chartPadTop  = 30
+	chartPadBot  = 45
+	chartPadRgt  = 15
+	chartTicks   = 5
+)
+
+var chartColors = []string{"#0d6efd", "#dc3545", "#198754", "#fd7e14", "#6f42c1", "#20c997", "#6c757d"}
+
+func chartColor(i int) string {
+	return chartColors[i%len(chartColors)]
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of 10, so that axis ticks are round numbers
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*exp {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+type chart struct {
+	sb strings.Builder
+
+	maxVal float64
+}
+
+func (c *chart) y(v float64) float64 {
+	plotHeight := float64(chartHeight - chartPadTop - chartPadBot)
+	return float64(chartHeight-chartPadBot) - v/c.maxVal*plotHeight
+}
+
+func (c *chart) begin(title string, maxVal float64, names []string) {
+	c.maxVal = niceCeil(maxVal)
+	fmt.Fprintf(&c.sb, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" style="max-width:100%%;height:auto;font-family:sans-serif;font-size:11px" role="img">`, chartWidth, chartHeight, chartWidth, chartHeight)
+	fmt.Fprintf(&c.sb, `<title>%s</title>`, template.HTMLEscapeString(title))
+	fmt.Fprintf(&c.sb, `<text x="%d" y="16" font-size="13" font-weight="bold">%s</text>`, chartPadLeft, template.HTMLEscapeString(title))
+
+	// Legend, right aligned on the title line
+	x := chartWidth - chartPadRgt
+	for i := len(names) - 1; i >= 0; i-- {
+		x -= 7*len(names[i]) + 22
+		fmt.Fprintf(&c.sb, `<rect x="%d" y="7" width="10" height="10" fill="%s"/><text x="%d" y="16">%s</text>`, x, chartColor(i), x+14, template.HTMLEscapeString(names[i]))
+	}
+
+	for i := 0; i <= chartTicks; i++ {
+		v := c.maxVal * float64(i) / chartTicks
+		y := c.y(v)
+		fmt.Fprintf(&c.sb, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" stroke="#dee2e6"/>`, chartPadLeft, chartWidth-chartPadRgt, y, y)
+		fmt.Fprintf(&c.sb, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, chartPadLeft-5, y+4, formatNumber(v))
+	}
+}
+
+func (c *chart) xLabel(x float64, label string) {
+	fmt.Fprintf(&c.sb, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, x, chartHeight-chartPadBot+15, template.HTMLEscapeString(label))
+}
+
+func (c *chart) end() template.HTML {
+	c.sb.WriteString(`</svg>`)
+	return template.HTML(c.sb.String())
+}
+
+// chronological returns the periods oldest first, since the stats are kept newest first
+func chronological(days []daysStruct) []daysStruct {
+	out := make([]daysStruct, len(days))
+	for i := range days {
+		out[len(days)-1-i] = days[i]
+	}
+	return out
+}
+
+func maxMetric(days []daysStruct, metric func(*scraper.StatsRow) int) float64 {
+	var mx float64
+	for _, day := range days {
+		for _, row := range day.Platforms {
+			if row != nil {
+				mx = max(mx, float64(metric(row)))
+			}
+		}
+	}
+	return mx
+}
+
+// lineChart draws one line per platform. Periods where a platform has no data break its line.
+func lineChart(title string, days []daysStruct, names []string, labelFormat string, metric func(*scraper.StatsRow) int) template.HTML {
+	if len(days) == 0 {
+		return ""
+	}
+	days = chronological(days)
+
+	var c chart
+	c.begin(title, maxMetric(days, metric), names)
+
+	plotWidth := float64(chartWidth - chartPadLeft - chartPadRgt)
+	step := plotWidth / float64(max(len(days)-1, 1))
+	x := func(i int) float64 {
+		return float64(chartPadLeft) + float64(i)*step
+	}
+
+	labelEvery := max(1, len(days)/8)
+	for i, day := range days {
+		if i%labelEvery == 0 {
+			c.xLabel(x(i), day.DayUTC.Format(labelFormat))
+		}
+	}
+
+	for p := range names {
+		var segments []string
+		var points []string
+		for i, day := range days {
+			if p >= len(day.Platforms) || day.Platforms[p] == nil {
+				if len(points) > 0 {
+					segments = append(segments, strings.Join(points, " "))
+					points = nil
+				}
+				continue
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(i), c.y(float64(metric(day.Platforms[p])))))
+		}
+		if len(points) > 0 {
+			segments = append(segments, strings.Join(points, " "))
+		}
+		for _, seg := range segments {
+			fmt.Fprintf(&c.sb, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, seg, chartColor(p))
+		}
+	}
+
+	return c.end()
+}
+
+// barChart draws a group of bars per period, one bar per platform
+func barChart(title string, days []daysStruct, names []string, labelFormat string, metric func(*scraper.StatsRow) int) template.HTML {
+	if len(days) == 0 || len(names) == 0 {
+		return ""
+	}
+	days = chronological(days)
+
+	var c chart
+	c.begin(title, maxMetric(days, metric), names)
+
+	plotWidth := float64(chartWidth - chartPadLeft - chartPadRgt)
+	groupWidth := plotWidth / float64(len(days))
+	barWidth := groupWidth * 0.8 / float64(len(names))
+
+	labelEvery := max(1, len(days)/12)
+	for i, day := range days {
+		groupX := float64(chartPadLeft) + float64(i)*groupWidth
+		if i%labelEvery == 0 {
+			c.xLabel(groupX+groupWidth/2, day.DayUTC.Format(labelFormat))
+		}
+		for p, row := range day.Platforms {
+			if row == nil {
+				continue
+			}
+			val := float64(metric(row))
+			y := c.y(val)
+			fmt.Fprintf(&c.sb, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s %s: %s</title></rect>`,
+				groupX+groupWidth*0.1+float64(p)*barWidth, y, barWidth, float64(chartHeight-chartPadBot)-y, chartColor(p),
+				template.HTMLEscapeString(row.PlatformName), day.DayUTC.Format(labelFormat), formatNumber(val))
+		}
+	}
+
+	return c.end()
+}
+
+const (
+	heatmapCell    = 28
+	heatmapPadLeft = 40
+	heatmapPadTop  = 20
+)
+
+var weekdayNames = []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// heatmapChart draws a 7x24 grid of submission counts, colored by the share of the busiest cell
+func heatmapChart(h *scraper.Heatmap) template.HTML {
+	if h == nil {
+		return ""
+	}
+	width := heatmapPadLeft + 24*heatmapCell
+	height := heatmapPadTop + 7*heatmapCell
+	mx := max(h.Max(), 1)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" style="max-width:100%%;height:auto;font-family:sans-serif;font-size:11px" role="img">`, width, height, width, height)
+	for hour := 0; hour < 24; hour++ {
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="middle">%d</text>`, heatmapPadLeft+hour*heatmapCell+heatmapCell/2, heatmapPadTop-6, hour)
+	}
+	for day, counts := range h.Counts {
+		y := heatmapPadTop + day*heatmapCell
+		fmt.Fprintf(&sb, `<text x="%d" y="%d" text-anchor="end">%s</text>`, heatmapPadLeft-5, y+heatmapCell/2+4, weekdayNames[day])
+		for hour, cnt := range counts {
+			fmt.Fprintf(&sb, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" fill-opacity="%.2f" stroke="#fff"><title>%s %02d:00: %s</title></rect>`,
+				heatmapPadLeft+hour*heatmapCell, y, heatmapCell, heatmapCell, chartColor(0), 0.05+0.95*float64(cnt)/float64(mx),
+				weekdayNames[day], hour, formatNumber(cnt))
+		}
+	}
+	sb.WriteString(`</svg>`)
+	return template.HTML(sb.String())
+}
@@ -0,0 +1,362 @@
+package codeforcesscraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+type cfProblem struct {
+	ContestID      int    `json:"contestId"`
+	ProblemsetName string `json:"problemsetName"`
+	Index          string `json:"index"`
+	Name           string `json:"name"`
+}
+
+type cfMember struct {
+	Handle string `json:"handle"`
+}
+
+type cfParty struct {
+	Members  []cfMember `json:"members"`
+	TeamName string     `json:"teamName"`
+}
+
+type cfSubmission struct {
+	ID                  int       `json:"id"`
+	CreationTimeSeconds int64     `json:"creationTimeSeconds"`
+	Problem             cfProblem `json:"problem"`
+	Author              cfParty   `json:"author"`
+	// Missing while the submission is waiting to be judged
+	Verdict string `json:"verdict"`
+}
+
+type CFResponse struct {
+	Status  string         `json:"status"`
+	Comment string         `json:"comment"`
+	Result  []cfSubmission `json:"result"`
+}
+
+const (
+	defaultBaseURL = "https://codeforces.com/api"
+	// Codeforces allows one API call every 2 seconds
+	defaultInterval = 2 * time.Second
+	// Maximum number of submissions returned by problemset.recentStatus
+	defaultPageSize = 1000
+)
+
+// Offset is a position in the submissions of the tracked users, newest first.
+// The zero offset fetches the newest problemset submissions, along with the newest page of every tracked user
+type Offset struct {
+	// 1-based index of the tracked user whose submissions are fetched
+	User int
+	// 1-based position of the first submission fetched for each tracked user
+	From []int
+}
+
+func (o Offset) String() string {
+	if o.User == 0 {
+		return "recent"
+	}
+	if o.User > len(o.From) {
+		return "end"
+	}
+	return fmt.Sprintf("user %d from %d", o.User, o.From[o.User-1])
+}
+
+var _ scraper.Parser[Offset] = &CFParser{}
+
+// CFParser scrapes the newest problemset submissions of Codeforces and every submission (gym ones included) of the tracked users
+type CFParser struct {
+	// Address of the API, defaults to https://codeforces.com/api
+	BaseURL string
+	// Handles of the tracked users
+	Users []string
+	// Submissions requested in each call, defaults to 1000
+	PageSize int
+	// Minimum time between API calls, defaults to 2 seconds
+	Interval time.Duration
+
+	mu       sync.Mutex
+	nextCall time.Time
+	// Tracked users (by index in Users) whose oldest submission has been fetched
+	done map[int]bool
+}
+
+func (p *CFParser) baseURL() string {
+	if p.BaseURL == "" {
+		return defaultBaseURL
+	}
+	return strings.TrimSuffix(p.BaseURL, "/")
+}
+
+func (p *CFParser) pageSize() int {
+	if p.PageSize <= 0 {
+		return defaultPageSize
+	}
+	return p.PageSize
+}
+
+// wait blocks until the next API call is allowed
+func (p *CFParser) wait(ctx context.Context) error {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	p.mu.Lock()
+	at := p.nextCall
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	p.nextCall = at.Add(interval)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *CFParser) isDone(user int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done[user]
+}
+
+func (p *CFParser) setDone(user int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done == nil {
+		p.done = make(map[int]bool)
+	}
+	p.done[user] = true
+}
+
+func (p *CFParser) call(ctx context.Context, method string, params url.Values) ([]cfSubmission, error) {
+	if err := p.wait(ctx); err != nil {
+		return nil, err
+	}
+	resp, err := scraper.Get(ctx, p.baseURL()+"/"+method+"?"+params.Encode(), nil)
+	if err != nil {
+		// Bad requests, such as unknown handles, explain themselves in the comment of a FAILED response
+		var statusErr *scraper.StatusError
+		var data CFResponse
+		if errors.As(err, &statusErr) && json.Unmarshal(statusErr.Body, &data) == nil && data.Status == "FAILED" {
+			return nil, fmt.Errorf("codeforces %s failed: %s: %w", method, data.Comment, err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data CFResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, scraper.ParseError(err)
+	}
+	if data.Status != "OK" {
+		return nil, scraper.ParseError(fmt.Errorf("codeforces %s returned status %q: %s", method, data.Status, data.Comment))
+	}
+	return data.Result, nil
+}
+
+// convert maps a Codeforces submission. handle is the tracked user it was fetched for, if any, since team submissions have several authors
+func convert(s cfSubmission, handle string) *scraper.Submission {
+	sub := &scraper.Submission{
+		ID:      s.ID,
+		Date:    time.Unix(s.CreationTimeSeconds, 0),
+		Handled: true,
+	}
+
+	for _, member := range s.Author.Members {
+		if handle == "" || strings.EqualFold(member.Handle, handle) {
+			sub.Username = member.Handle
+			break
+		}
+	}
+	if sub.Username == "" {
+		sub.Username = handle
+	}
+	if sub.Username == "" {
+		sub.Username = s.Author.TeamName
+	}
+	sub.DisplayName = sub.Username
+
+	problemID := s.Problem.ProblemsetName + "/" + s.Problem.Index
+	if s.Problem.ContestID != 0 {
+		problemID = strconv.Itoa(s.Problem.ContestID) + s.Problem.Index
+	}
+	sub.ProblemID = &problemID
+	name := s.Problem.Name
+	sub.ProblemName = &name
+
+	score := 0
+	switch s.Verdict {
+	case "", "SUBMITTED", "TESTING":
+		sub.Handled = false
+		return sub
+	case "OK":
+		score = 100
+	case "PARTIAL":
+		// Points of partially solved problems are not out of 100
+		return sub
+	case "COMPILATION_ERROR":
+		sub.CompileError = true
+	case "FAILED", "CRASHED", "INPUT_PREPARATION_CRASHED":
+		sub.InternalError = true
+		return sub
+	case "SKIPPED":
+		sub.Ignored = true
+		return sub
+	}
+	sub.Score = &score
+	return sub
+}
+
+// userPage fetches the submissions of Users[user-1], starting at position from
+func (p *CFParser) userPage(ctx context.Context, user int, from int) ([]*scraper.Submission, error) {
+	handle := p.Users[user-1]
+	res, err := p.call(ctx, "user.status", url.Values{
+		"handle": {handle},
+		"from":   {strconv.Itoa(from)},
+		"count":  {strconv.Itoa(p.pageSize())},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("user %s: %w", handle, err)
+	}
+	if len(res) < p.pageSize() {
+		p.setDone(user)
+	}
+	subs := make([]*scraper.Submission, 0, len(res))
+	for _, s := range res {
+		subs = append(subs, convert(s, handle))
+	}
+	return subs, nil
+}
+
+func (p *CFParser) GetPage(ctx context.Context, offset Offset) ([]*scraper.Submission, error) {
+	if offset.User == 0 {
+		// The tracked users come first, so that their team submissions are attributed to them
+		seen := make(map[int]bool)
+		var subs []*scraper.Submission
+		for user := 1; user <= len(p.Users); user++ {
+			page, err := p.userPage(ctx, user, 1)
+			if err != nil {
+				return nil, err
+			}
+			for _, sub := range page {
+				if !seen[sub.ID] {
+					seen[sub.ID] = true
+					subs = append(subs, sub)
+				}
+			}
+		}
+		res, err := p.call(ctx, "problemset.recentStatus", url.Values{"count": {strconv.Itoa(p.pageSize())}})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range res {
+			if !seen[s.ID] {
+				seen[s.ID] = true
+				subs = append(subs, convert(s, ""))
+			}
+		}
+		return subs, nil
+	}
+
+	// Users whose oldest submission was reached are skipped, the page is empty once every user is done
+	for user := offset.User; user <= len(p.Users); user++ {
+		if p.isDone(user) {
+			continue
+		}
+		from := 1
+		if user <= len(offset.From) {
+			from = offset.From[user-1]
+		}
+		subs, err := p.userPage(ctx, user, from)
+		if err != nil {
+			return nil, err
+		}
+		if len(subs) > 0 {
+			return subs, nil
+		}
+	}
+	return nil, nil
+}
+
+func (p *CFParser) PageZeroOffset() Offset {
+	return Offset{}
+}
+
+// FurthestOffset continues every tracked user after their stored submissions.
+// New submissions come first, so the stored ones of a user are at most the first ones in the API's order
+func (p *CFParser) FurthestOffset(ctx context.Context, db *scraper.DB) (Offset, error) {
+	offset := Offset{User: 1, From: make([]int, len(p.Users))}
+	for i, handle := range p.Users {
+		cnt, err := db.CountUserSubmissions(ctx, handle)
+		if err != nil {
+			return Offset{}, err
+		}
+		offset.From[i] = cnt + 1
+	}
+	return offset, nil
+}
+
+func (p *CFParser) NextPageOffset(t Offset, subs []*scraper.Submission) Offset {
+	next := Offset{User: t.User, From: make([]int, len(p.Users))}
+	for i := range next.From {
+		next.From[i] = 1
+	}
+	copy(next.From, t.From)
+	if t.User == 0 {
+		for i := range next.From {
+			next.From[i] = p.pageSize() + 1
+		}
+		next.User = 1
+		return next
+	}
+	if len(subs) == 0 {
+		next.User = len(p.Users) + 1
+		return next
+	}
+
+	// GetPage skips the users that are done, so the page belongs to the first of the following users that it matches
+	user := t.User
+	for user <= len(p.Users) && !strings.EqualFold(p.Users[user-1], subs[0].Username) {
+		user++
+	}
+	if user > len(p.Users) {
+		next.User = len(p.Users) + 1
+		return next
+	}
+	next.User = user
+	next.From[user-1] += len(subs)
+	if len(subs) < p.pageSize() {
+		next.User++
+	}
+	return next
+}
+
+// ProblemURL links to a problem of the problemset or of a gym, whose contest IDs start at 100000
+func (p *CFParser) ProblemURL(problemID string) string {
+	digits := len(problemID) - len(strings.TrimLeft(problemID, "0123456789"))
+	if digits == 0 || digits == len(problemID) {
+		return ""
+	}
+	contestID, _ := strconv.Atoi(problemID[:digits])
+	index := url.PathEscape(problemID[digits:])
+	web := strings.TrimSuffix(p.baseURL(), "/api")
+	if contestID >= 100000 {
+		return fmt.Sprintf("%s/gym/%d/problem/%s", web, contestID, index)
+	}
+	return fmt.Sprintf("%s/problemset/problem/%d/%s", web, contestID, index)
+}
@@ -0,0 +1,320 @@
+package codeforcesscraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+// apiServer stands in for the Codeforces API, serving the responses recorded in testdata.
+// user.status is paged by from and count, unknown handles fail like on Codeforces
+type apiServer struct {
+	*httptest.Server
+
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+func newAPIServer(t *testing.T) *apiServer {
+	t.Helper()
+	srv := &apiServer{}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.mu.Lock()
+		srv.calls = append(srv.calls, time.Now())
+		srv.mu.Unlock()
+
+		q := r.URL.Query()
+		var file string
+		switch r.URL.Path {
+		case "/api/problemset.recentStatus":
+			file = "recent_status.json"
+		case "/api/user.status":
+			file = "user_status_" + strings.ToLower(q.Get("handle")) + ".json"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", file))
+		if errors.Is(err, fs.ErrNotExist) {
+			data, err = os.ReadFile("testdata/unknown_handle.json")
+			if err != nil {
+				t.Error(err)
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(data)
+			return
+		} else if err != nil {
+			t.Error(err)
+			return
+		}
+
+		var resp struct {
+			Status string            `json:"status"`
+			Result []json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Error(err)
+			return
+		}
+		from, count := 1, len(resp.Result)
+		if val := q.Get("from"); val != "" {
+			from, _ = strconv.Atoi(val)
+		}
+		if val := q.Get("count"); val != "" {
+			count, _ = strconv.Atoi(val)
+		}
+		start := min(from-1, len(resp.Result))
+		resp.Result = resp.Result[start:min(start+count, len(resp.Result))]
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (s *apiServer) parser(pageSize int, users ...string) *CFParser {
+	return &CFParser{BaseURL: s.URL + "/api", Users: users, PageSize: pageSize, Interval: time.Millisecond}
+}
+
+func ids(subs []*scraper.Submission) []int {
+	var ids []int
+	for _, sub := range subs {
+		ids = append(ids, sub.ID)
+	}
+	return ids
+}
+
+func TestConvert(t *testing.T) {
+	hundred, zero := 100, 0
+	for _, tc := range []struct {
+		verdict string
+		want    scraper.Submission
+	}{
+		{"OK", scraper.Submission{Score: &hundred, Handled: true}},
+		{"WRONG_ANSWER", scraper.Submission{Score: &zero, Handled: true}},
+		{"TIME_LIMIT_EXCEEDED", scraper.Submission{Score: &zero, Handled: true}},
+		{"COMPILATION_ERROR", scraper.Submission{Score: &zero, CompileError: true, Handled: true}},
+		{"PARTIAL", scraper.Submission{Handled: true}},
+		{"FAILED", scraper.Submission{InternalError: true, Handled: true}},
+		{"CRASHED", scraper.Submission{InternalError: true, Handled: true}},
+		{"SKIPPED", scraper.Submission{Ignored: true, Handled: true}},
+		{"TESTING", scraper.Submission{}},
+		{"", scraper.Submission{}},
+	} {
+		sub := convert(cfSubmission{ID: 1, Verdict: tc.verdict, Author: cfParty{Members: []cfMember{{"tourist"}}}}, "")
+		if (sub.Score == nil) != (tc.want.Score == nil) || (sub.Score != nil && *sub.Score != *tc.want.Score) {
+			t.Errorf("%q: got score %v, want %v", tc.verdict, sub.Score, tc.want.Score)
+		}
+		if sub.CompileError != tc.want.CompileError || sub.InternalError != tc.want.InternalError || sub.Ignored != tc.want.Ignored || sub.Handled != tc.want.Handled {
+			t.Errorf("%q: got compile error %t, internal error %t, ignored %t, handled %t, want %t, %t, %t, %t", tc.verdict,
+				sub.CompileError, sub.InternalError, sub.Ignored, sub.Handled,
+				tc.want.CompileError, tc.want.InternalError, tc.want.Ignored, tc.want.Handled)
+		}
+	}
+}
+
+func TestConvertAuthorAndProblem(t *testing.T) {
+	team := cfSubmission{
+		ID:      1,
+		Problem: cfProblem{ContestID: 104114, Index: "B", Name: "Binary Strings"},
+		Author:  cfParty{Members: []cfMember{{"Um_nik"}, {"tourist"}}, TeamName: "Spb SU 4"},
+		Verdict: "OK",
+	}
+	if sub := convert(team, ""); sub.Username != "Um_nik" {
+		t.Errorf("untracked team submission attributed to %q, want its first member", sub.Username)
+	}
+	if sub := convert(team, "Tourist"); sub.Username != "tourist" {
+		t.Errorf("team submission fetched for a tracked user attributed to %q, want tourist", sub.Username)
+	}
+	if sub := convert(cfSubmission{Author: cfParty{TeamName: "Spb SU 4"}}, ""); sub.Username != "Spb SU 4" {
+		t.Errorf("submission without members attributed to %q, want the team name", sub.Username)
+	}
+
+	sub := convert(team, "")
+	if *sub.ProblemID != "104114B" || *sub.ProblemName != "Binary Strings" {
+		t.Errorf("got problem %q %q", *sub.ProblemID, *sub.ProblemName)
+	}
+	p := &CFParser{}
+	if got, want := p.ProblemURL(*sub.ProblemID), "https://codeforces.com/gym/104114/problem/B"; got != want {
+		t.Errorf("got gym problem URL %q, want %q", got, want)
+	}
+	if got, want := p.ProblemURL("1950A"), "https://codeforces.com/problemset/problem/1950/A"; got != want {
+		t.Errorf("got problem URL %q, want %q", got, want)
+	}
+	acm := convert(cfSubmission{Problem: cfProblem{ProblemsetName: "acmsguru", Index: "100"}}, "")
+	if *acm.ProblemID != "acmsguru/100" || p.ProblemURL(*acm.ProblemID) != "" {
+		t.Errorf("got problem %q with URL %q for a problem outside of contests", *acm.ProblemID, p.ProblemURL(*acm.ProblemID))
+	}
+}
+
+func TestPageZero(t *testing.T) {
+	srv := newAPIServer(t)
+	p := srv.parser(2, "tourist", "Petr")
+	subs, err := p.GetPage(context.Background(), p.PageZeroOffset())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The team submission 255000105 is also the second recent one, it must be kept once, for tourist
+	if got, want := ids(subs), []int{255000105, 255000104, 255000205, 255000204, 255000301}; !slices.Equal(got, want) {
+		t.Fatalf("got page %v, want %v", got, want)
+	}
+	if subs[0].Username != "tourist" {
+		t.Errorf("team submission attributed to %q, want tourist", subs[0].Username)
+	}
+}
+
+// TestOffsets walks the backlog of several tracked users, checking the offsets and the pages fetched at each of them
+func TestOffsets(t *testing.T) {
+	type page struct {
+		offset string
+		ids    []int
+	}
+	for _, tc := range []struct {
+		name     string
+		pageSize int
+		users    []string
+		want     []page
+	}{
+		{"pages of each user", 2, []string{"tourist", "Petr"}, []page{
+			{"recent", []int{255000105, 255000104, 255000205, 255000204, 255000301}},
+			{"user 1 from 3", []int{255000103, 255000102}},
+			{"user 1 from 5", []int{255000101}},
+			{"user 2 from 3", []int{255000203}},
+			{"end", nil},
+		}},
+		// Petr is done after an empty page, so the page at his offset belongs to tourist
+		{"skipping done users", 3, []string{"Petr", "tourist"}, []page{
+			{"recent", []int{255000205, 255000204, 255000203, 255000105, 255000104, 255000103, 255000301, 255000300}},
+			{"user 1 from 4", []int{255000102, 255000101}},
+			{"end", nil},
+		}},
+		// Users done on page zero are not fetched again
+		{"done on page zero", 5, []string{"tourist", "Petr"}, []page{
+			{"recent", []int{255000105, 255000104, 255000103, 255000102, 255000101, 255000205, 255000204, 255000203, 255000301, 255000300, 255000299}},
+			{"user 1 from 6", nil},
+			{"end", nil},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newAPIServer(t)
+			p := srv.parser(tc.pageSize, tc.users...)
+			offset := p.PageZeroOffset()
+			for i, want := range tc.want {
+				if offset.String() != want.offset {
+					t.Fatalf("page %d: got offset %q, want %q", i, offset, want.offset)
+				}
+				subs, err := p.GetPage(context.Background(), offset)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := ids(subs); !slices.Equal(got, want.ids) {
+					t.Fatalf("page %d at %q: got %v, want %v", i, offset, got, want.ids)
+				}
+				offset = p.NextPageOffset(offset, subs)
+			}
+		})
+	}
+}
+
+// TestFurthestOffset checks that the backlog continues after the stored submissions of every tracked user
+func TestFurthestOffset(t *testing.T) {
+	srv := newAPIServer(t)
+	p := srv.parser(2, "tourist", "Petr")
+	db, err := scraper.NewDB("Codeforces", filepath.Join(t.TempDir(), "dump.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	offset, err := p.FurthestOffset(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset.String() != "user 1 from 1" || !slices.Equal(offset.From, []int{1, 1}) {
+		t.Errorf("got offset %q %v on an empty database", offset, offset.From)
+	}
+
+	subs, err := p.GetPage(ctx, p.PageZeroOffset())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.InsertMonitorPage(ctx, subs); err != nil {
+		t.Fatal(err)
+	}
+	offset, err = p.FurthestOffset(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := p.NextPageOffset(p.PageZeroOffset(), subs); offset.User != want.User || !slices.Equal(offset.From, want.From) {
+		t.Errorf("got offset %q %v after page zero, want %q %v", offset, offset.From, want, want.From)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := newAPIServer(t)
+	p := srv.parser(2, "tourist", "Petr")
+	p.Interval = 50 * time.Millisecond
+	if _, err := p.GetPage(context.Background(), p.PageZeroOffset()); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.calls) != 3 {
+		t.Fatalf("got %d API calls for page zero, want 3", len(srv.calls))
+	}
+	// Requests reach the server a few milliseconds after being sent, so the gaps between them vary a bit
+	const slack = 10 * time.Millisecond
+	for i := 1; i < len(srv.calls); i++ {
+		if gap := srv.calls[i].Sub(srv.calls[i-1]); gap < p.Interval-slack {
+			t.Errorf("API calls %d and %d are %s apart, want at least %s", i-1, i, gap, p.Interval)
+		}
+	}
+
+	// The next call is due in an interval, so a canceled wait returns right away
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v from a canceled wait", err)
+	}
+}
+
+func TestUnknownHandle(t *testing.T) {
+	srv := newAPIServer(t)
+	p := srv.parser(2, "tourist", "nobody")
+	_, err := p.GetPage(context.Background(), p.PageZeroOffset())
+	if err == nil {
+		t.Fatal("got no error for an unknown handle")
+	}
+	if !strings.Contains(err.Error(), "User with handle nobody not found") {
+		t.Errorf("error %q does not include the comment of the API", err)
+	}
+	if scraper.Retryable(err) {
+		t.Errorf("error %q is retryable", err)
+	}
+}
+
+// TestFailedStatus checks that a failed call answered with 200 OK is not retried either
+func TestFailedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "FAILED", "comment": "Call limit exceeded"}`))
+	}))
+	defer srv.Close()
+	p := &CFParser{BaseURL: srv.URL + "/api", Interval: time.Millisecond}
+	_, err := p.GetPage(context.Background(), p.PageZeroOffset())
+	if err == nil {
+		t.Fatal("got no error for a failed call")
+	}
+	if !errors.Is(err, scraper.ErrParse) || scraper.Retryable(err) {
+		t.Errorf("error %q is not a parse error", err)
+	}
+}
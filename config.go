@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+// FileConfig is the JSON configuration file given with -config. See config.example.json
+type FileConfig struct {
+	// Per-platform settings, keyed by platform name (Kilonova, Infoarena, Nerdarena, CSAcademy, Campion, Codeforces)
+	Platforms map[string]*PlatformConfig `json:"platforms"`
+}
+
+type PlatformConfig struct {
+	// Submissions left out of every statistic
+	Exclude *scraper.Exclusions `json:"exclude"`
+
+	// Monitor page of a platform without a built-in parser, which is then scraped like the others
+	Monitor *scraper.MonitorConfig `json:"monitor"`
+	// Dump of a monitor platform, defaults to dump_<name>.db with the name in lowercase
+	Database string `json:"database"`
+}
+
+// Platforms with a built-in parser, which cannot be configured with a monitor page
+var builtinPlatforms = []string{Kilonova, "Infoarena", "Nerdarena", "CSAcademy", "Campion", "Codeforces"}
+
+// Exclusions used for platforms not present in the config file
+var defaultExclusions = map[string]*scraper.Exclusions{
+	Kilonova: {Users: []string{"2951"}},
+}
+
+func LoadConfig(path string) (*FileConfig, error) {
+	var conf FileConfig
+	if path == "" {
+		return &conf, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, fmt.Errorf("could not parse config file: %w", err)
+	}
+	for name, pl := range conf.Platforms {
+		if pl == nil {
+			continue
+		}
+		if err := pl.Exclude.Validate(); err != nil {
+			return nil, fmt.Errorf("platform %s: %w", name, err)
+		}
+		if pl.Monitor != nil && slices.Contains(builtinPlatforms, name) {
+			return nil, fmt.Errorf("platform %s has a built-in parser and cannot have a monitor", name)
+		}
+	}
+	return &conf, nil
+}
+
+func (c *FileConfig) Platform(name string) *PlatformConfig {
+	if pl, ok := c.Platforms[name]; ok && pl != nil {
+		return pl
+	}
+	return &PlatformConfig{Exclude: defaultExclusions[name]}
+}
+
+// Monitors returns the scrapers of the platforms configured with a monitor page, sorted by name
+func (c *FileConfig) Monitors() ([]*scraper.Scraper[int], error) {
+	var names []string
+	for name, pl := range c.Platforms {
+		if pl != nil && pl.Monitor != nil {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	var scrapers []*scraper.Scraper[int]
+	for _, name := range names {
+		pl := c.Platforms[name]
+		parser, err := scraper.NewDeclarativeParser(*pl.Monitor)
+		if err != nil {
+			return nil, fmt.Errorf("platform %s: %w", name, err)
+		}
+		dbname := pl.Database
+		if dbname == "" {
+			dbname = "dump_" + strings.ToLower(name) + ".db"
+		}
+		sc, err := scraper.New(name, dbname, parser)
+		if err != nil {
+			return nil, fmt.Errorf("platform %s: %w", name, err)
+		}
+		scrapers = append(scrapers, sc)
+	}
+	return scrapers, nil
+}
+
+// StatsOptions returns the stats options for a platform, with its exclusions applied
+func (c *FileConfig) StatsOptions(name string, opts scraper.StatsOptions) scraper.StatsOptions {
+	opts.Exclude = c.Platform(name).Exclude
+	return opts
+}
@@ -86,19 +86,14 @@ func (p *CSAParser) GetPage(ctx context.Context, offset *time.Time) ([]*scraper.
 		Path:     "/eval/get_eval_jobs/",
 		RawQuery: q,
 	}
-	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Add("x-requested-with", "XMLHttpRequest")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := scraper.Get(ctx, url.String(), http.Header{"X-Requested-With": {"XMLHttpRequest"}})
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	var data CSAResponse
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, err
+		return nil, scraper.ParseError(err)
 	}
 
 	var users = make(map[int]csaUser)
@@ -110,7 +105,7 @@ func (p *CSAParser) GetPage(ctx context.Context, offset *time.Time) ([]*scraper.
 	for _, job := range data.State.EvalJob {
 		user, ok := users[job.UserID]
 		if !ok {
-			zap.S().Warn("Could not find user")
+			zap.S().Warnw("Could not find user", "user_id", job.UserID, "submission_id", job.ID)
 			user = csaUser{ID: -1, Username: "", Name: ""}
 		}
 
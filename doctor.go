@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+func writeDoctorReports(w io.Writer, reports []*scraper.DoctorReport, repair bool, output string) error {
+	if output == OutputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(reports)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, report := range reports {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "%s (%d submissions)\n", report.Platform, report.Submissions)
+		fmt.Fprintln(tw, "CHECK\tCOUNT\tREPAIRED\tSAMPLES")
+		for _, check := range report.Checks {
+			repaired := "-"
+			if check.Repairable && repair {
+				repaired = fmt.Sprint(check.Repaired)
+			} else if check.Repairable && check.Count > 0 {
+				repaired = "with -repair"
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", check.Name, check.Count, repaired, strings.Join(check.Samples, ", "))
+		}
+	}
+	return tw.Flush()
+}
+
+// runDoctor runs the doctor subcommand: integrity checks of the submission dumps, optionally repairing them
+func runDoctor(ctx context.Context, args []string, dbs []*scraper.DB, w io.Writer) error {
+	switch *output {
+	case OutputTable, OutputJSON:
+	default:
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "Repair the affected rows where possible (rewriting or deleting bad dates, deleting future-dated rows and invalid IDs, clearing impossible scores, unifying display names)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var reports []*scraper.DoctorReport
+	for _, db := range dbs {
+		report, err := db.Doctor(ctx, *repair)
+		if err != nil {
+			return fmt.Errorf("%s: %w", db.PlatformName, err)
+		}
+		reports = append(reports, report)
+	}
+	return writeDoctorReports(w, reports, *repair, *output)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+const (
+	FormatHTML     = "html"
+	FormatJSON     = "json"
+	FormatCSV      = "csv"
+	FormatMarkdown = "markdown"
+)
+
+// ParseFormats splits a comma-separated list of export formats, validating each one.
+func ParseFormats(s string) ([]string, error) {
+	var formats []string
+	for _, format := range strings.Split(s, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		switch format {
+		case "":
+			continue
+		case "md":
+			format = FormatMarkdown
+		case FormatHTML, FormatJSON, FormatCSV, FormatMarkdown:
+		default:
+			return nil, fmt.Errorf("unknown export format %q", format)
+		}
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		return nil, fmt.Errorf("no export format specified")
+	}
+	return formats, nil
+}
+
+// ParseExtraQueries builds the queries for the additional granularities, all sharing the same range and limit.
+// from and to are dates in YYYY-MM-DD format in the reporting timezone, or empty.
+func ParseExtraQueries(granularities, from, to string, limit int, loc *time.Location) ([]scraper.StatsQuery, error) {
+	// The extra tables show the user activity like the regular ones
+	q := scraper.StatsQuery{Limit: limit, Location: loc, UserActivity: true}
+	if from != "" {
+		t, err := time.ParseInLocation(time.DateOnly, from, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start date: %w", err)
+		}
+		q.From = t
+	}
+	if to != "" {
+		t, err := time.ParseInLocation(time.DateOnly, to, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end date: %w", err)
+		}
+		q.To = t
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return nil, fmt.Errorf("start date must be before end date")
+	}
+
+	var queries []scraper.StatsQuery
+	for _, val := range strings.Split(granularities, ",") {
+		if strings.TrimSpace(val) == "" {
+			continue
+		}
+		g, err := scraper.ParseGranularity(val)
+		if err != nil {
+			return nil, err
+		}
+		q.Granularity = g
+		queries = append(queries, q)
+	}
+	return queries, nil
+}
+
+// statsTable is one granularity of the exported statistics, with all platforms aligned per period.
+type statsTable struct {
+	Name  string
+	Title string
+
+	Granularity scraper.Granularity
+	Rows        []daysStruct
+}
+
+func statsTables(conf *Config) []statsTable {
+	days, months, rolling := allStats(conf)
+	tables := []statsTable{
+		{
+			Name:        "days",
+			Title:       fmt.Sprintf("Statistics for the last %d days", conf.NumDays),
+			Granularity: scraper.Daily,
+			Rows:        days,
+		},
+		{
+			Name:        "rolling",
+			Title:       fmt.Sprintf("Statistics for the last %d %d-day intervals", conf.NumRollingMonths, conf.RollingInterval),
+			Granularity: scraper.Rolling(conf.RollingInterval),
+			Rows:        rolling,
+		},
+		{
+			Name:        "months",
+			Title:       fmt.Sprintf("Statistics for the last %d calendar months", conf.NumMonths),
+			Granularity: scraper.Monthly,
+			Rows:        months,
+		},
+	}
+	for _, extra := range extraStats(conf) {
+		tables = append(tables, statsTable{
+			Name:        extra.Granularity.String(),
+			Title:       "Statistics per " + extra.Granularity.String() + " " + extra.RangeLabel(),
+			Granularity: extra.Granularity,
+			Rows:        extra.Rows,
+		})
+	}
+	return tables
+}
+
+type jsonExport struct {
+	LastUpdatedAt time.Time `json:"last_updated_at"`
+	Timezone      string    `json:"timezone"`
+
+	NumDays          int `json:"num_days"`
+	NumMonths        int `json:"num_months"`
+	RollingInterval  int `json:"rolling_interval"`
+	NumRollingMonths int `json:"num_rolling_months"`
+
+	Platforms []*scraper.Statistics `json:"platforms"`
+}
+
+func ExportToJSON(ctx context.Context, conf *Config, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(jsonExport{
+		LastUpdatedAt: time.Now().UTC(),
+		Timezone:      conf.Loc().String(),
+
+		NumDays:          conf.NumDays,
+		NumMonths:        conf.NumMonths,
+		RollingInterval:  conf.RollingInterval,
+		NumRollingMonths: conf.NumRollingMonths,
+
+		Platforms: conf.Platforms,
+	})
+}
+
+var csvHeader = []string{
+	"platform", "period_start", "period_end",
+	"num_submissions", "excluding_multiple", "unique_users", "unique_problems",
+	"full_score", "full_score_rate", "compile_errors", "compile_error_rate", "internal_errors", "internal_error_rate",
+	"mean_score", "median_score", "solved_pairs",
+	"new_users", "returning_users", "churned_users",
+	"wau", "mau", "dau_mau",
+}
+
+func formatCSVInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func formatCSVFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func csvTimeFormat(g scraper.Granularity) string {
+	if g.Unit == scraper.UnitHour {
+		return "2006-01-02 15:04"
+	}
+	return time.DateOnly
+}
+
+func exportTableToCSV(table statsTable, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, day := range table.Rows {
+		for _, row := range day.Platforms {
+			if row == nil {
+				continue
+			}
+			if err := cw.Write([]string{
+				row.PlatformName,
+				day.DayUTC.Format(csvTimeFormat(table.Granularity)),
+				table.Granularity.Next(day.DayUTC).Format(csvTimeFormat(table.Granularity)),
+				strconv.Itoa(row.NumSubmissions),
+				strconv.Itoa(row.ExcludingMultiple),
+				strconv.Itoa(row.UniqueUsers),
+				strconv.Itoa(row.UniqueProblems),
+				strconv.Itoa(row.FullScore),
+				formatCSVFloat(&row.FullScoreRate),
+				strconv.Itoa(row.CompileErrors),
+				formatCSVFloat(&row.CompileErrorRate),
+				strconv.Itoa(row.InternalErrors),
+				formatCSVFloat(&row.InternalErrorRate),
+				formatCSVFloat(row.MeanScore),
+				formatCSVFloat(row.MedianScore),
+				strconv.Itoa(row.SolvedPairs),
+				strconv.Itoa(row.NewUsers),
+				strconv.Itoa(row.ReturningUsers),
+				formatCSVInt(row.ChurnedUsers),
+				formatCSVInt(row.WeeklyActiveUsers),
+				formatCSVInt(row.MonthlyActiveUsers),
+				formatCSVFloat(row.Stickiness),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportCohortsToCSV(conf *Config, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"platform", "cohort_month", "users"}
+	for i := 0; i < conf.NumCohorts; i++ {
+		header = append(header, "month_"+strconv.Itoa(i))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, pl := range conf.Platforms {
+		for _, cohort := range pl.Cohorts {
+			record := []string{pl.PlatformName, cohort.Month.Format("2006-01"), strconv.Itoa(cohort.Users)}
+			for i := 0; i < conf.NumCohorts; i++ {
+				if i < len(cohort.Retention) {
+					record = append(record, formatCSVFloat(&cohort.Retention[i]))
+				} else {
+					record = append(record, "")
+				}
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func ExportToMarkdown(ctx context.Context, conf *Config, w io.Writer) error {
+	var names []string
+	for _, pl := range conf.Platforms {
+		names = append(names, pl.PlatformName)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## %s submission activity statistics\n\n", strings.Join(names, "/"))
+	fmt.Fprintf(&sb, "Last updated at: %s.\n\n", time.Now().In(conf.Loc()).Format("2006-01-02 15:04:05 MST"))
+	for _, pl := range conf.Platforms {
+		fmt.Fprintf(&sb, "* Last submission found (%s): %s\n", pl.PlatformName, pl.LastSubmission.In(conf.Loc()).Format("2006-01-02 15:04:05 MST"))
+	}
+	for _, pl := range conf.Platforms {
+		for _, excl := range pl.Excluded {
+			fmt.Fprintf(&sb, "* Excluded from %s: `%s` (%d submissions)\n", pl.PlatformName, excl.Rule, excl.Count)
+		}
+	}
+
+	for _, table := range statsTables(conf) {
+		if len(table.Rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n### %s\n\n", table.Title)
+
+		fmt.Fprintf(&sb, "| Period (%s) |", conf.Loc())
+		for _, name := range names {
+			fmt.Fprintf(&sb, " %[1]s subs | %[1]s unique pairs | %[1]s users | %[1]s problems |", name)
+		}
+		sb.WriteString("\n|---|")
+		sb.WriteString(strings.Repeat("--:|", 4*len(names)))
+		sb.WriteString("\n")
+
+		for _, day := range table.Rows {
+			fmt.Fprintf(&sb, "| %s |", table.Granularity.Label(day.DayUTC))
+			for _, row := range day.Platforms {
+				if row == nil {
+					sb.WriteString(" N/A | N/A | N/A | N/A |")
+					continue
+				}
+				fmt.Fprintf(&sb, " %d | %d | %d | %d |", row.NumSubmissions, row.ExcludingMultiple, row.UniqueUsers, row.UniqueProblems)
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// exportPath derives the output path for a format from the base export path, keeping its directory and stem.
+func exportPath(base, suffix string) string {
+	return strings.TrimSuffix(base, filepath.Ext(base)) + suffix
+}
+
+func writeFile(path string, f func(w io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := f(file); err != nil {
+		file.Close()
+		return err
+	}
+	zap.S().Infof("Exported %s", path)
+	return file.Close()
+}
+
+// Export writes the statistics in every requested format. The HTML body goes to basePath as-is,
+// the other formats are placed next to it with their own extension. Nothing is written if two of them would get the same path.
+// The platform statistics should include the lookback periods, which are trimmed after computing the trends.
+func Export(ctx context.Context, conf *Config, formats []string, basePath string) error {
+	prepareStats(conf)
+	type exportFile struct {
+		format string
+		path   string
+		write  func(w io.Writer) error
+	}
+	var files []exportFile
+	for _, format := range formats {
+		switch format {
+		case FormatHTML:
+			files = append(files, exportFile{format, basePath, func(w io.Writer) error {
+				return ExportToVROBody(ctx, conf, w)
+			}})
+		case FormatJSON:
+			files = append(files, exportFile{format, exportPath(basePath, ".json"), func(w io.Writer) error {
+				return ExportToJSON(ctx, conf, w)
+			}})
+		case FormatMarkdown:
+			files = append(files, exportFile{format, exportPath(basePath, ".md"), func(w io.Writer) error {
+				return ExportToMarkdown(ctx, conf, w)
+			}})
+		case FormatCSV:
+			for _, table := range statsTables(conf) {
+				table := table
+				files = append(files, exportFile{format, exportPath(basePath, "_"+table.Name+".csv"), func(w io.Writer) error {
+					return exportTableToCSV(table, w)
+				}})
+			}
+			if conf.NumCohorts > 0 {
+				files = append(files, exportFile{format, exportPath(basePath, "_cohorts.csv"), func(w io.Writer) error {
+					return exportCohortsToCSV(conf, w)
+				}})
+			}
+		default:
+			return fmt.Errorf("unknown export format %q", format)
+		}
+	}
+
+	// The HTML is written to the export path as given, so with an extension such as .json it would be overwritten
+	written := make(map[string]string)
+	for _, file := range files {
+		if other, ok := written[file.path]; ok && other != file.format {
+			return fmt.Errorf("the %s and %s exports would both be written to %s, use an export path ending in .html", other, file.format, file.path)
+		}
+		written[file.path] = file.format
+	}
+	for _, file := range files {
+		if err := writeFile(file.path, file.write); err != nil {
+			return err
+		}
+	}
+	return nil
+}
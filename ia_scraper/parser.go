@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
@@ -39,12 +38,16 @@ const iaFormat = "_2 January 06 15:04:05"
 func parseSubmission(node *html.Node) (*scraper.Submission, error) {
 	sel := goquery.NewDocumentFromNode(node)
 
+	if len(sel.Children().Nodes) < 7 || sel.Children().Nodes[5].FirstChild == nil {
+		return nil, scraper.ParseError(errors.New("unexpected monitor row"))
+	}
+
 	var sub = new(scraper.Submission)
 	idText := strings.TrimSpace(goquery.NewDocumentFromNode(sel.Children().Nodes[0]).Text())
 	id, err := strconv.Atoi(strings.TrimPrefix(idText, "#"))
 	if err != nil {
-		zap.S().Warn("Invalid ID from ", idText)
-		return nil, err
+		zap.S().Warnw("Invalid submission ID", "id", idText)
+		return nil, scraper.ParseError(err)
 	}
 	sub.ID = id
 	sub.Handled = true
@@ -79,7 +82,7 @@ func parseSubmission(node *html.Node) (*scraper.Submission, error) {
 		sizeText = strings.ReplaceAll(sizeText, ",", ".")
 		size, err := strconv.ParseFloat(sizeText, 64)
 		if err != nil {
-			zap.S().Warnf("Invalid size string %q (id: %d)", sizeText, sub.ID)
+			zap.S().Warnw("Invalid size string", "size", sizeText, "submission_id", sub.ID)
 		} else {
 			sub.SizeKB = &size
 		}
@@ -93,8 +96,8 @@ func parseSubmission(node *html.Node) (*scraper.Submission, error) {
 	}
 	t, err := time.ParseInLocation(iaFormat, date, location)
 	if err != nil {
-		zap.S().Info("Invalid time from infoarena: ", date)
-		return nil, errors.New("invalid time")
+		zap.S().Infow("Invalid submission time", "date", date, "submission_id", sub.ID)
+		return nil, scraper.ParseError(errors.New("invalid time"))
 	}
 	sub.Date = t
 
@@ -117,7 +120,7 @@ func parseSubmission(node *html.Node) (*scraper.Submission, error) {
 			var score int
 			if len(parts) == 2 {
 				if _, err := fmt.Sscanf(parts[1], "%d", &score); err != nil {
-					zap.S().Warn("Scanf error: ", err)
+					zap.S().Warnw("Invalid score", "status", statusText, "submission_id", sub.ID, "error", err)
 				}
 				sub.Score = &score
 			} // else {
@@ -144,18 +147,14 @@ func ParseMonitorPage(ctx context.Context, host string, offset int) ([]*scraper.
 		Path:     "monitor",
 		RawQuery: fmt.Sprintf("display_entries=%d&only_table=true&first_entry=%d", entriesCount, offset),
 	}
-	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := scraper.Get(ctx, url.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, scraper.ParseError(err)
 	}
 	sel := doc.Selection
 	if doc.Find("#monitor-table").Length() > 0 { // Full page, NerdArena, go to monitor table
@@ -172,7 +171,7 @@ func ParseMonitorPage(ctx context.Context, host string, offset int) ([]*scraper.
 	return subs, nil
 }
 
-var _ scraper.Parser[int] = &IAParser{}
+var _ scraper.PagedParser[int] = &IAParser{}
 
 type IAParser struct {
 	Host string
@@ -190,6 +189,14 @@ func (p *IAParser) NextPageOffset(t int, subs []*scraper.Submission) int {
 	return t + len(subs)
 }
 
+func (p *IAParser) PageOffset(start int, n int) int {
+	return start + n*entriesCount
+}
+
+func (p *IAParser) ProblemURL(problemID string) string {
+	return "https://" + p.Host + "/problema/" + url.PathEscape(problemID)
+}
+
 func (p *IAParser) GetPage(ctx context.Context, offset int) ([]*scraper.Submission, error) {
 	return ParseMonitorPage(ctx, p.Host, offset)
 }
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+const (
+	LinkUsername    = "username"
+	LinkDisplayName = "display_name"
+	LinkManual      = "manual"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// Account is a user of a platform
+type Account struct {
+	Platform string `json:"platform"`
+	Username string `json:"username"`
+}
+
+func (a Account) String() string {
+	return a.Platform + "/" + a.Username
+}
+
+// Identity is a person's accounts across platforms
+type Identity struct {
+	// Usernames keyed by platform name
+	Accounts map[string]string `json:"accounts"`
+	// Methods the accounts were linked by
+	Methods []string `json:"methods"`
+}
+
+// LinkProposal is a possible match between accounts of two platforms
+type LinkProposal struct {
+	Method string  `json:"method"`
+	A      Account `json:"a"`
+	B      Account `json:"b"`
+}
+
+// LinkStore holds the confirmed identities, saved as JSON at -links_path
+type LinkStore struct {
+	Identities []*Identity `json:"identities"`
+
+	byAccount map[Account]*Identity
+}
+
+// LoadLinks reads the confirmed links. A missing file means no links
+func LoadLinks(path string) (*LinkStore, error) {
+	var store LinkStore
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return nil, fmt.Errorf("could not parse links file: %w", err)
+	}
+	return &store, nil
+}
+
+func (s *LinkStore) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s *LinkStore) find(a Account) *Identity {
+	if s.byAccount == nil {
+		s.byAccount = make(map[Account]*Identity)
+		for _, id := range s.Identities {
+			s.index(id)
+		}
+	}
+	return s.byAccount[a]
+}
+
+func (s *LinkStore) index(id *Identity) {
+	for platform, username := range id.Accounts {
+		s.byAccount[Account{Platform: platform, Username: username}] = id
+	}
+}
+
+// Linked returns whether both accounts belong to the same identity
+func (s *LinkStore) Linked(a, b Account) bool {
+	id := s.find(a)
+	return id != nil && id == s.find(b)
+}
+
+func conflicts(a, b map[string]string) bool {
+	for platform, username := range a {
+		if other, ok := b[platform]; ok && other != username {
+			return true
+		}
+	}
+	return false
+}
+
+func appendMethod(methods []string, method string) []string {
+	if slices.Contains(methods, method) {
+		return methods
+	}
+	return append(methods, method)
+}
+
+// Link stores a proposal, merging the identities of its accounts.
+// It returns an error if the accounts, or the identities they would merge, have two accounts on the same platform.
+func (s *LinkStore) Link(p LinkProposal) error {
+	if p.A.Platform == p.B.Platform {
+		return fmt.Errorf("cannot link %s and %s: they are on the same platform", p.A, p.B)
+	}
+	ida, idb := s.find(p.A), s.find(p.B)
+	switch {
+	case ida == nil && idb == nil:
+		id := &Identity{
+			Accounts: map[string]string{p.A.Platform: p.A.Username, p.B.Platform: p.B.Username},
+			Methods:  []string{p.Method},
+		}
+		s.Identities = append(s.Identities, id)
+		s.index(id)
+		return nil
+	case ida == nil:
+		ida, idb = idb, ida
+		p.A, p.B = p.B, p.A
+	}
+
+	if idb == nil {
+		idb = &Identity{Accounts: map[string]string{p.B.Platform: p.B.Username}}
+	} else if ida == idb {
+		ida.Methods = appendMethod(ida.Methods, p.Method)
+		return nil
+	}
+	if conflicts(ida.Accounts, idb.Accounts) {
+		return fmt.Errorf("cannot link %s and %s: they are linked to different accounts of the same platform", p.A, p.B)
+	}
+	for platform, username := range idb.Accounts {
+		ida.Accounts[platform] = username
+	}
+	for _, method := range idb.Methods {
+		ida.Methods = appendMethod(ida.Methods, method)
+	}
+	ida.Methods = appendMethod(ida.Methods, p.Method)
+	s.index(ida)
+	s.Identities = slices.DeleteFunc(s.Identities, func(id *Identity) bool { return id == idb })
+	return nil
+}
+
+var diacritics = strings.NewReplacer(
+	"ă", "a", "â", "a", "î", "i", "ș", "s", "ş", "s", "ț", "t", "ţ", "t",
+	"Ă", "a", "Â", "a", "Î", "i", "Ș", "s", "Ş", "s", "Ț", "t", "Ţ", "t",
+)
+
+// normalizeName lowercases a display name, strips the romanian diacritics and sorts its words,
+// so that "Popescu Ștefan" and "stefan popescu" match
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(diacritics.Replace(name)), func(r rune) bool {
+		return r == ' ' || r == '-' || r == '.' || r == '\t'
+	})
+	slices.Sort(words)
+	return strings.Join(words, " ")
+}
+
+// uniqueIndex maps the keys of the users to their username, leaving out the keys shared by multiple users
+func uniqueIndex(users []scraper.UserSummary, key func(scraper.UserSummary) string) map[string]string {
+	idx := make(map[string]string)
+	dup := make(map[string]bool)
+	for _, user := range users {
+		k := key(user)
+		if k == "" {
+			continue
+		}
+		if _, ok := idx[k]; ok {
+			dup[k] = true
+		}
+		idx[k] = user.Username
+	}
+	for k := range dup {
+		delete(idx, k)
+	}
+	return idx
+}
+
+// ProposeLinks matches the users of every pair of platforms with the given methods.
+// Usernames and display names only match if they are unique on both platforms. Manual mappings are proposed as-is.
+func ProposeLinks(users map[string][]scraper.UserSummary, platforms []string, methods []string, mapping []map[string]string) []LinkProposal {
+	keys := map[string]func(scraper.UserSummary) string{
+		LinkUsername: func(u scraper.UserSummary) string {
+			return strings.ToLower(u.Username)
+		},
+		LinkDisplayName: func(u scraper.UserSummary) string {
+			// A single word is too common to identify anyone
+			if name := normalizeName(u.DisplayName); strings.Contains(name, " ") {
+				return name
+			}
+			return ""
+		},
+	}
+
+	var proposals []LinkProposal
+	seen := make(map[[2]Account]bool)
+	propose := func(method string, a, b Account) {
+		if seen[[2]Account{a, b}] {
+			return
+		}
+		seen[[2]Account{a, b}] = true
+		proposals = append(proposals, LinkProposal{Method: method, A: a, B: b})
+	}
+
+	for _, entry := range mapping {
+		var accounts []Account
+		for _, platform := range platforms {
+			if username, ok := entry[platform]; ok {
+				accounts = append(accounts, Account{Platform: platform, Username: username})
+			}
+		}
+		for i := range accounts {
+			for j := i + 1; j < len(accounts); j++ {
+				propose(LinkManual, accounts[i], accounts[j])
+			}
+		}
+	}
+
+	for _, method := range methods {
+		key, ok := keys[method]
+		if !ok {
+			continue
+		}
+		for i, pa := range platforms {
+			ia := uniqueIndex(users[pa], key)
+			for _, pb := range platforms[i+1:] {
+				ib := uniqueIndex(users[pb], key)
+				for k, ua := range ia {
+					if ub, ok := ib[k]; ok {
+						propose(method, Account{Platform: pa, Username: ua}, Account{Platform: pb, Username: ub})
+					}
+				}
+			}
+		}
+	}
+
+	// Manual mappings go first, so they take precedence when confirming conflicting proposals
+	slices.SortFunc(proposals, func(a, b LinkProposal) int {
+		if (a.Method == LinkManual) != (b.Method == LinkManual) {
+			if a.Method == LinkManual {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.A.String()+" "+a.B.String(), b.A.String()+" "+b.B.String())
+	})
+	return proposals
+}
+
+// LoadLinkMapping reads a manual mapping file: a JSON list of objects mapping platform names to usernames
+func LoadLinkMapping(path string) ([]map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mapping []map[string]string
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("could not parse link mapping file: %w", err)
+	}
+	return mapping, nil
+}
+
+// PlatformOverlap is the number of linked users active on both platforms
+type PlatformOverlap struct {
+	A     string `json:"a"`
+	B     string `json:"b"`
+	Users int    `json:"users"`
+}
+
+// Migration is a linked user whose last activity on a platform precedes their first activity on another one
+type Migration struct {
+	From Account `json:"from"`
+	To   Account `json:"to"`
+
+	LastFrom time.Time `json:"last_from"`
+	FirstTo  time.Time `json:"first_to"`
+}
+
+type MigrationFlow struct {
+	From       string      `json:"from"`
+	To         string      `json:"to"`
+	Migrations []Migration `json:"migrations"`
+}
+
+type LinkReport struct {
+	// Number of active users of each platform
+	Users map[string]int `json:"users"`
+	// Number of stored identities
+	Identities int `json:"identities"`
+
+	Overlaps []PlatformOverlap `json:"overlaps"`
+	Flows    []MigrationFlow   `json:"flows"`
+}
+
+// BuildLinkReport computes the overlaps and migration flows between every pair of platforms from the stored identities
+func BuildLinkReport(store *LinkStore, users map[string][]scraper.UserSummary, platforms []string) *LinkReport {
+	report := &LinkReport{Users: make(map[string]int), Identities: len(store.Identities)}
+	summaries := make(map[Account]scraper.UserSummary)
+	for _, platform := range platforms {
+		report.Users[platform] = len(users[platform])
+		for _, user := range users[platform] {
+			summaries[Account{Platform: platform, Username: user.Username}] = user
+		}
+	}
+
+	for i, pa := range platforms {
+		for _, pb := range platforms[i+1:] {
+			overlap := PlatformOverlap{A: pa, B: pb}
+			forward := MigrationFlow{From: pa, To: pb, Migrations: []Migration{}}
+			backward := MigrationFlow{From: pb, To: pa, Migrations: []Migration{}}
+			for _, id := range store.Identities {
+				a := Account{Platform: pa, Username: id.Accounts[pa]}
+				b := Account{Platform: pb, Username: id.Accounts[pb]}
+				ua, ok1 := summaries[a]
+				ub, ok2 := summaries[b]
+				if !ok1 || !ok2 {
+					continue
+				}
+				overlap.Users++
+				if ua.LastSubmission.Before(ub.FirstSubmission) {
+					forward.Migrations = append(forward.Migrations, Migration{From: a, To: b, LastFrom: ua.LastSubmission, FirstTo: ub.FirstSubmission})
+				}
+				if ub.LastSubmission.Before(ua.FirstSubmission) {
+					backward.Migrations = append(backward.Migrations, Migration{From: b, To: a, LastFrom: ub.LastSubmission, FirstTo: ua.FirstSubmission})
+				}
+			}
+			report.Overlaps = append(report.Overlaps, overlap)
+			report.Flows = append(report.Flows, forward, backward)
+		}
+	}
+	return report
+}
+
+func writeProposals(w io.Writer, proposals []LinkProposal, output string) error {
+	if output == OutputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(proposals)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tACCOUNT\tACCOUNT")
+	for _, p := range proposals {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Method, p.A, p.B)
+	}
+	return tw.Flush()
+}
+
+func writeLinkReport(w io.Writer, report *LinkReport, platforms []string, output string) error {
+	if output == OutputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(report)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Identities:\t%d\n", report.Identities)
+	for _, platform := range platforms {
+		fmt.Fprintf(tw, "Active users (%s):\t%d\n", platform, report.Users[platform])
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "PLATFORMS\tLINKED USERS")
+	for _, o := range report.Overlaps {
+		fmt.Fprintf(tw, "%s - %s\t%d\n", o.A, o.B, o.Users)
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "MIGRATION\tUSERS")
+	for _, f := range report.Flows {
+		fmt.Fprintf(tw, "%s -> %s\t%d\n", f.From, f.To, len(f.Migrations))
+	}
+	return tw.Flush()
+}
+
+// readConfirmedLinks reads the links given to link confirm: a proposals file (the JSON output of link propose, edited down to the right matches)
+// or account pairs written as Platform/username=Platform/username
+func readConfirmedLinks(args []string) ([]LinkProposal, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing links to confirm: a proposals file (the JSON output of link propose) or Platform/username=Platform/username pairs")
+	}
+	if len(args) == 1 && !strings.Contains(args[0], "=") {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return nil, err
+		}
+		var proposals []LinkProposal
+		if err := json.Unmarshal(data, &proposals); err != nil {
+			return nil, fmt.Errorf("could not parse proposals file %s: %w", args[0], err)
+		}
+		for i := range proposals {
+			if proposals[i].Method == "" {
+				proposals[i].Method = LinkManual
+			}
+			if p := proposals[i]; p.A.Platform == p.B.Platform {
+				return nil, fmt.Errorf("proposal %d of %s links %s and %s, which are on the same platform", i+1, args[0], p.A, p.B)
+			}
+		}
+		return proposals, nil
+	}
+
+	var proposals []LinkProposal
+	for _, arg := range args {
+		a, b, _ := strings.Cut(arg, "=")
+		accA, okA := parseAccount(a)
+		accB, okB := parseAccount(b)
+		if !okA || !okB {
+			return nil, fmt.Errorf("invalid link %q, expected Platform/username=Platform/username", arg)
+		}
+		if accA.Platform == accB.Platform {
+			return nil, fmt.Errorf("invalid link %q, the accounts are on the same platform", arg)
+		}
+		proposals = append(proposals, LinkProposal{Method: LinkManual, A: accA, B: accB})
+	}
+	return proposals, nil
+}
+
+// parseAccount parses an account written as Platform/username, the way Account prints it
+func parseAccount(s string) (Account, bool) {
+	platform, username, ok := strings.Cut(s, "/")
+	return Account{Platform: platform, Username: username}, ok && platform != "" && username != ""
+}
+
+// runLink runs the link subcommand: propose, confirm or report
+func runLink(ctx context.Context, args []string, sources []scraper.StatsSource, config *FileConfig, w io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing link command (propose, confirm or report)")
+	}
+	switch *output {
+	case OutputTable, OutputJSON:
+	default:
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	var platforms []string
+	users := make(map[string][]scraper.UserSummary)
+	for _, src := range sources {
+		list, err := src.UserSummaries(ctx, config.Platform(src.Platform()).Exclude)
+		if err != nil {
+			return fmt.Errorf("could not list %s users: %w", src.Platform(), err)
+		}
+		platforms = append(platforms, src.Platform())
+		users[src.Platform()] = list
+	}
+
+	store, err := LoadLinks(*linksPath)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "propose":
+		mapping, err := LoadLinkMapping(*linkMapping)
+		if err != nil {
+			return err
+		}
+		var proposals []LinkProposal
+		for _, p := range ProposeLinks(users, platforms, strings.Split(*linkMethods, ","), mapping) {
+			if !store.Linked(p.A, p.B) {
+				proposals = append(proposals, p)
+			}
+		}
+		return writeProposals(w, proposals, *output)
+	case "confirm":
+		proposals, err := readConfirmedLinks(args[1:])
+		if err != nil {
+			return err
+		}
+		// Typos in the edited file must not link accounts that do not exist
+		known := make(map[Account]bool)
+		for platform, list := range users {
+			for _, user := range list {
+				known[Account{Platform: platform, Username: user.Username}] = true
+			}
+		}
+		for _, p := range proposals {
+			for _, acc := range []Account{p.A, p.B} {
+				if !known[acc] {
+					return fmt.Errorf("unknown account %s", acc)
+				}
+			}
+		}
+
+		var confirmed []LinkProposal
+		for _, p := range proposals {
+			if store.Linked(p.A, p.B) {
+				continue
+			}
+			if err := store.Link(p); err != nil {
+				zap.S().Warn(err)
+				continue
+			}
+			confirmed = append(confirmed, p)
+		}
+		if err := store.Save(*linksPath); err != nil {
+			return err
+		}
+		return writeProposals(w, confirmed, *output)
+	case "report":
+		return writeLinkReport(w, BuildLinkReport(store, users, platforms), platforms, *output)
+	}
+	return fmt.Errorf("unknown link command %q", args[0])
+}
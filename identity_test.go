@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkSamePlatform(t *testing.T) {
+	var store LinkStore
+	err := store.Link(LinkProposal{
+		Method: LinkManual,
+		A:      Account{Platform: "Infoarena", Username: "alexv"},
+		B:      Account{Platform: "Infoarena", Username: "alexv2"},
+	})
+	if err == nil {
+		t.Error("linked two accounts of the same platform")
+	}
+	if len(store.Identities) != 0 {
+		t.Errorf("got identities %v after a rejected link", store.Identities)
+	}
+
+	if _, err := readConfirmedLinks([]string{"Infoarena/alexv=Infoarena/alexv2"}); err == nil {
+		t.Error("confirmed a pair on the same platform")
+	}
+	path := filepath.Join(t.TempDir(), "proposals.json")
+	data := `[{"a": {"platform": "Infoarena", "username": "alexv"}, "b": {"platform": "Infoarena", "username": "alexv2"}}]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readConfirmedLinks([]string{path}); err == nil {
+		t.Error("confirmed a proposal on the same platform")
+	}
+
+	proposals, err := readConfirmedLinks([]string{"Infoarena/alexv=Kilonova/AlexVasiluta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Link(proposals[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !store.Linked(proposals[0].A, proposals[0].B) {
+		t.Error("accounts of different platforms are not linked")
+	}
+}
@@ -0,0 +1,159 @@
+package kilonovascraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+// knScore is a submission score, which the API may encode either as a number or as a decimal string
+type knScore float64
+
+func (s *knScore) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	if string(data) == "null" || len(data) == 0 {
+		*s = knScore(math.NaN())
+		return nil
+	}
+	f, err := strconv.ParseFloat(string(data), 64)
+	if err != nil {
+		return err
+	}
+	*s = knScore(f)
+	return nil
+}
+
+type knSubmission struct {
+	ID           int       `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UserID       int       `json:"user_id"`
+	ProblemID    int       `json:"problem_id"`
+	Language     string    `json:"language"`
+	CodeSize     int       `json:"code_size"`
+	Status       string    `json:"status"`
+	CompileError *bool     `json:"compile_error"`
+	Score        knScore   `json:"score"`
+}
+
+type knUser struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type knProblem struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type KNResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		Submissions []knSubmission       `json:"submissions"`
+		Count       int                  `json:"count"`
+		Users       map[string]knUser    `json:"users"`
+		Problems    map[string]knProblem `json:"problems"`
+	} `json:"data"`
+}
+
+const entriesCount = 50
+
+var _ scraper.PagedParser[int] = &KNParser{}
+
+// KNParser scrapes the public submission list of a Kilonova instance, newest first
+type KNParser struct {
+	Host string
+}
+
+func (p *KNParser) PageZeroOffset() int {
+	return 0
+}
+
+func (p *KNParser) FurthestOffset(ctx context.Context, db *scraper.DB) (int, error) {
+	return db.CountSubmissions(ctx)
+}
+
+func (p *KNParser) NextPageOffset(t int, subs []*scraper.Submission) int {
+	return t + len(subs)
+}
+
+func (p *KNParser) PageOffset(start int, n int) int {
+	return start + n*entriesCount
+}
+
+func (p *KNParser) ProblemURL(problemID string) string {
+	return "https://" + p.Host + "/problems/" + url.PathEscape(problemID)
+}
+
+func (p *KNParser) GetPage(ctx context.Context, offset int) ([]*scraper.Submission, error) {
+	url := url.URL{
+		Scheme:   "https",
+		Host:     p.Host,
+		Path:     "/api/submissions/get",
+		RawQuery: fmt.Sprintf("ordering=id&ascending=false&limit=%d&offset=%d", entriesCount, offset),
+	}
+	resp, err := scraper.Get(ctx, url.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var data KNResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, scraper.ParseError(err)
+	}
+	if data.Status != "success" {
+		return nil, scraper.ParseError(fmt.Errorf("kilonova returned status %q", data.Status))
+	}
+
+	subs := make([]*scraper.Submission, 0, len(data.Data.Submissions))
+	for _, sub := range data.Data.Submissions {
+		// Users are identified by name, the same way the database source lists them. Exclusions may also give their ID
+		userID := strconv.Itoa(sub.UserID)
+		user := data.Data.Users[userID]
+		if user.Name == "" {
+			user.Name = userID
+		}
+
+		pbid := strconv.Itoa(sub.ProblemID)
+		var pbname *string
+		if pb, ok := data.Data.Problems[pbid]; ok {
+			pbname = &pb.Name
+		}
+
+		var sizeKB *float64
+		if sub.CodeSize > 0 {
+			kb := float64(sub.CodeSize) / 1024.0
+			sizeKB = &kb
+		}
+
+		var score *int
+		if scc := float64(sub.Score); !math.IsNaN(scc) {
+			s := int(math.Round(scc))
+			score = &s
+		}
+
+		subs = append(subs, &scraper.Submission{
+			ID:            sub.ID,
+			Username:      user.Name,
+			DisplayName:   user.DisplayName,
+			UserID:        &userID,
+			ProblemID:     &pbid,
+			ProblemName:   pbname,
+			SizeKB:        sizeKB,
+			Date:          sub.CreatedAt,
+			Ignored:       false,
+			CompileError:  sub.CompileError != nil && *sub.CompileError,
+			InternalError: false, // Kilonova has no internal error verdict
+			Handled:       sub.Status == "finished",
+			Score:         score,
+		})
+	}
+	return subs, nil
+}
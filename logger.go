@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -10,32 +14,146 @@ import (
 
 // snip from kilonova
 
-func initLogger(debug bool) error {
+const (
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
+)
+
+// LogOptions configures the global logger
+type LogOptions struct {
+	Level  string
+	Format string
+
+	// Also log to this file, rotating it once it grows over MaxSize bytes and keeping MaxFiles old files. Empty disables it
+	File     string
+	MaxSize  int64
+	MaxFiles int
+}
+
+func newEncoder(format string, color bool) (zapcore.Encoder, error) {
 	var encConf zapcore.EncoderConfig
-	if debug {
+	switch format {
+	case LogFormatConsole:
 		encConf = zap.NewDevelopmentEncoderConfig()
-	} else {
-		encConf = zap.NewDevelopmentEncoderConfig()
-		// encConf = zap.NewProductionEncoderConfig()
+	case LogFormatJSON:
+		encConf = zap.NewProductionEncoderConfig()
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
 	}
 	encConf.EncodeTime = zapcore.TimeEncoder(func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 		enc.AppendString(t.UTC().Format(time.RFC3339))
 	})
-	encConf.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	if format == LogFormatJSON {
+		return zapcore.NewJSONEncoder(encConf), nil
+	}
+	encConf.EncodeLevel = zapcore.CapitalLevelEncoder
+	if color {
+		encConf.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+	return zapcore.NewConsoleEncoder(encConf), nil
+}
 
-	level := zapcore.InfoLevel
-	if debug {
-		level = zapcore.DebugLevel
+func initLogger(opts LogOptions) error {
+	level, err := zapcore.ParseLevel(opts.Level)
+	if err != nil {
+		return err
 	}
 
-	core := zapcore.NewCore(zapcore.NewConsoleEncoder(encConf), zapcore.AddSync(os.Stdout), level)
-	logg := zap.New(core, zap.AddCaller())
+	enc, err := newEncoder(opts.Format, true)
+	if err != nil {
+		return err
+	}
+	core := zapcore.NewCore(enc, zapcore.AddSync(os.Stdout), level)
 
-	zap.ReplaceGlobals(logg)
+	if opts.File != "" {
+		fileEnc, err := newEncoder(opts.Format, false)
+		if err != nil {
+			return err
+		}
+		file, err := openRotatingFile(opts.File, opts.MaxSize, opts.MaxFiles)
+		if err != nil {
+			return err
+		}
+		core = zapcore.NewTee(core, zapcore.NewCore(fileEnc, file, level))
+	}
 
+	zap.ReplaceGlobals(zap.New(core, zap.AddCaller()))
 	return nil
 }
 
-func init() {
-	initLogger(true)
+// rotatingFile is a log file that is renamed to path.1 (shifting the older ones to path.2, ...) once it grows too large
+type rotatingFile struct {
+	mu sync.Mutex
+
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	file *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, stat.Size()
+	return nil
+}
+
+// rotate closes the file and reopens it at path after shifting the old files.
+// If that fails, the file is reopened as it is, so that the logs keep going somewhere
+func (f *rotatingFile) rotate() error {
+	err := f.file.Close()
+	if err == nil {
+		err = f.shift()
+	}
+	return errors.Join(err, f.open())
+}
+
+// shift renames path to path.1, path.1 to path.2 and so on, or removes path if no old files are kept
+func (f *rotatingFile) shift() error {
+	if f.maxFiles <= 0 {
+		return os.Remove(f.path)
+	}
+	for i := f.maxFiles - 1; i > 0; i-- {
+		// Missing older files are fine, the log just has not rotated that many times yet
+		if err := os.Rename(f.path+"."+strconv.Itoa(i), f.path+"."+strconv.Itoa(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(f.path, f.path+".1")
+}
+
+// Write rotates the file before it grows past maxSize. A failed rotation is returned, but p is still written
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rotateErr error
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		rotateErr = f.rotate()
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, errors.Join(rotateErr, err)
+}
+
+func (f *rotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Sync()
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.txt")
+	f, err := openRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.file.Close()
+	// A non-empty directory in the way of path.1 makes the rename fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("second\n")); err == nil {
+		t.Error("got no error for a failed rotation")
+	}
+	if _, err := f.Write([]byte("third\n")); err == nil {
+		t.Error("got no error for another failed rotation")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first\nsecond\nthird\n"; string(data) != want {
+		t.Errorf("got log %q, want %q", data, want)
+	}
+}
@@ -2,37 +2,131 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
+	codeforcesscraper "vasiluta.ro/ia_kn_stats/codeforces_scraper"
 	csacademyscraper "vasiluta.ro/ia_kn_stats/csacademy_scraper"
 	"vasiluta.ro/ia_kn_stats/ia_scraper"
+	kilonovascraper "vasiluta.ro/ia_kn_stats/kilonova_scraper"
 	"vasiluta.ro/ia_kn_stats/scraper"
 )
 
 var (
 	scrapeForward   = flag.Bool("scrape_forward", false, "Whether to scrape forward in search of submissions")
+	scrapeWorkers   = flag.Int("scrape_workers", 4, "Number of pages fetched concurrently when scraping forward, 1 fetches one page at a time")
+	scrapeRate      = flag.Float64("scrape_rate", 2, "Maximum number of pages fetched per second from each platform when scraping forward, 0 means no limit")
+	scrapeQueue     = flag.Int("scrape_queue", 16, "Maximum number of pages fetched ahead of the database writer when scraping forward")
+	scrapeBatch     = flag.Int("scrape_batch", 4, "Number of pages committed to the database at once when scraping forward")
 	exportStats     = flag.Bool("export_stats", true, "Export stats to html file")
 	exportStatsPath = flag.String("export_path", "./out.html", "Path to export stats to")
+	exportFormat    = flag.String("format", FormatHTML, "Comma-separated export formats (html, json, csv, markdown). Non-HTML outputs are written next to export_path")
+	exportTemplate  = flag.String("template", "", "Path to a template file to use instead of the embedded templ.body")
+	exportPage      = flag.Bool("standalone", false, "Export a full standalone HTML page with inline CSS instead of a blog body fragment")
+	exportCharts    = flag.Bool("charts", true, "Embed SVG charts in the exported HTML")
+	exportVerdicts  = flag.Bool("verdict_columns", false, "Add verdict breakdown columns (full scores, error rates, mean/median score, solved pairs) to the HTML tables")
 	exportDays      = flag.Int("export_days", 180, "Show stats from last x days")
 
 	exportMonths        = flag.Int("export_months", 12, "Show stats from last x calendar months")
 	exportRollingMonths = flag.Int("export_roll_months", 6, "Show stats from last x rolling month intervals")
 	exportRollInterval  = flag.Int("export_roll_days", 30, "Number of days in rolling month interval")
+	exportCohorts       = flag.Int("export_cohorts", 12, "Show the retention of users first seen in each of the last x calendar months, 0 disables the cohort table")
+	exportHeatmapDays   = flag.Int("export_heatmap_days", 90, "Show a day of week/hour of day submission heatmap over the last x days, 0 disables it")
 
-	kilonovaDSN = flag.String("kilonova_dsn", "", "DSN to connect to kn database")
+	exportGranularities = flag.String("export_granularities", "", "Comma-separated extra granularities to export: hour, day, week, month, quarter, year or Nd (N-day intervals)")
+	exportFrom          = flag.String("export_from", "", "Start date (YYYY-MM-DD) for the extra granularities. Empty means since the first submission")
+	exportTo            = flag.String("export_to", "", "End date (YYYY-MM-DD, exclusive) for the extra granularities. Empty means until the end of today")
+	exportPeriods       = flag.Int("export_periods", 0, "Show at most x periods for each extra granularity, 0 means all periods in range")
+
+	leaderboardTop         = flag.Int("leaderboard_top", 10, "Number of entries in the top problems/users leaderboards, 0 disables them")
+	leaderboardPeriods     = flag.Int("leaderboard_periods", 1, "Show leaderboards for the last x periods, including the current one")
+	leaderboardGranularity = flag.String("leaderboard_granularity", "month", "Period of the leaderboards: day, week, month, quarter, year or Nd")
+
+	configPath = flag.String("config", "", "Path to the JSON config file (see config.example.json)")
+	timezone   = flag.String("timezone", "UTC", "Reporting timezone (such as Europe/Bucharest) that statistics are bucketed in")
+
+	kilonovaDSN    = flag.String("kilonova_dsn", "", "DSN to connect to kn database")
+	kilonovaSource = flag.String("kilonova_source", KilonovaSourceDB, "Where kilonova stats come from: db (the kn database, see kilonova_dsn) or api (scrape the public submissions API into a local dump)")
+
+	output      = flag.String("output", OutputTable, "Output format of the subcommands: table or json")
+	linksPath   = flag.String("links_path", "links.json", "Path to the confirmed cross-platform user links")
+	linkMapping = flag.String("link_mapping", "", "Path to a manual mapping file: a JSON list of objects mapping platform names to usernames")
+	linkMethods = flag.String("link_methods", "username,display_name", "Comma-separated methods to propose links by: username, display_name")
+
+	problemsPath      = flag.String("problems_path", "problems.json", "Path to the cross-platform problem mapping table")
+	problemSimilarity = flag.Float64("problem_similarity", 0.85, "Minimum similarity (0 to 1) of problem names to propose a mapping")
+	problemDays       = flag.Int("problem_days", 365, "Compare problem activity over the last x days")
+
+	logLevel    = flag.String("log_level", "debug", "Minimum level of logged messages: debug, info, warn or error")
+	logFormat   = flag.String("log_format", LogFormatConsole, "Log format: console or json (one object per line, for machine parsing)")
+	logFile     = flag.String("log_file", "", "Also write logs to this file, rotating it as it grows. Empty disables it")
+	logMaxSize  = flag.Int("log_max_size_mb", 100, "Rotate the log file once it grows over x MB")
+	logMaxFiles = flag.Int("log_max_files", 5, "Number of rotated log files to keep")
+
+	metricsAddr = flag.String("metrics_addr", "", "Address (such as :9090) to serve Prometheus metrics of the scrapers on, at /metrics. Empty disables it")
 
 	kilonovaFlag  = flag.Bool("kilonova", true, "Add stats for kilonova")
 	infoarenaFlag = flag.Bool("infoarena", true, "Add stats for infoarena")
 	nerdarenaFlag = flag.Bool("nerdarena", true, "Add stats for nerdarena")
 	csacademyFlag = flag.Bool("csacademy", false, "Add stats for csacademy")
 	campionFlag   = flag.Bool("campion", false, "Add stats for campion.edu.ro")
+
+	codeforcesFlag  = flag.Bool("codeforces", false, "Add stats for codeforces")
+	codeforcesUsers = flag.String("codeforces_users", "", "Comma-separated Codeforces handles whose submissions (gym ones included) are scraped, besides the newest problemset submissions")
 )
 
 func main() {
 	flag.Parse()
+	if err := initLogger(LogOptions{
+		Level:    *logLevel,
+		Format:   *logFormat,
+		File:     *logFile,
+		MaxSize:  int64(*logMaxSize) << 20,
+		MaxFiles: *logMaxFiles,
+	}); err != nil {
+		fmt.Fprintln(os.Stderr, "Could not set up logging:", err)
+		os.Exit(1)
+	}
+	defer zap.L().Sync()
+	formats, err := ParseFormats(*exportFormat)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	loc, err := time.LoadLocation(*timezone)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	extraQueries, err := ParseExtraQueries(*exportGranularities, *exportFrom, *exportTo, *exportPeriods, loc)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	leaderboardGran, err := scraper.ParseGranularity(*leaderboardGranularity)
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+
+	var syncOpts scraper.SyncOptions
+	if flag.Arg(0) == "sync" {
+		if syncOpts, err = parseSyncArgs(flag.Args()[1:], loc); err != nil {
+			zap.S().Fatal(err)
+		}
+		scraper.ReadOnly = syncOpts.DryRun
+	}
+	// The stats of the kn database are not needed to scrape or check the dumps
+	scrapeOnly := flag.Arg(0) == "sync" || flag.Arg(0) == "doctor"
+
 	nerdarena, err := scraper.New("Nerdarena", "dump_nerdarena.db", &ia_scraper.IAParser{Host: "www.nerdarena.ro"})
 	if err != nil {
 		zap.S().Fatal(err)
@@ -54,137 +148,292 @@ func main() {
 		zap.S().Fatal(err)
 	}
 
+	var cfUsers []string
+	for _, handle := range strings.Split(*codeforcesUsers, ",") {
+		if handle = strings.TrimSpace(handle); handle != "" {
+			cfUsers = append(cfUsers, handle)
+		}
+	}
+	codeforces, err := scraper.New("Codeforces", "dump_codeforces.db", &codeforcesscraper.CFParser{Users: cfUsers})
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+
+	// kilonova is only scraped when its stats come from the public API
+	var kilonova *scraper.Scraper[int]
+	var sources []scraper.StatsSource
+	if *kilonovaFlag {
+		switch *kilonovaSource {
+		case KilonovaSourceDB:
+			if scrapeOnly {
+				break
+			}
+			if *kilonovaDSN == "" {
+				zap.S().Fatal("Empty kilonova DSN, use -kilonova_source=api to scrape the public API instead")
+			}
+			sources = append(sources, &KilonovaDB{DSN: *kilonovaDSN})
+		case KilonovaSourceAPI:
+			kilonova, err = scraper.New(Kilonova, "dump_kilonova.db", &kilonovascraper.KNParser{Host: "kilonova.ro"})
+			if err != nil {
+				zap.S().Fatal(err)
+			}
+			sources = append(sources, kilonova.DB)
+		default:
+			zap.S().Fatalf("Unknown kilonova source %q", *kilonovaSource)
+		}
+	}
+	for _, x := range []struct {
+		enabled bool
+		db      *scraper.DB
+	}{{*infoarenaFlag, infoarena.DB}, {*nerdarenaFlag, nerdarena.DB}, {*csacademyFlag, csacademy.DB}, {*campionFlag, campion.DB}, {*codeforcesFlag, codeforces.DB}} {
+		if x.enabled {
+			sources = append(sources, x.db)
+		}
+	}
+	// Platforms configured with a monitor page are always enabled
+	monitors, err := config.Monitors()
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+	for _, sc := range monitors {
+		sources = append(sources, sc.DB)
+	}
+
+	switch flag.Arg(0) {
+	case "":
+	case "link", "problems":
+		run := runLink
+		if flag.Arg(0) == "problems" {
+			run = runProblems
+		}
+		if err := run(context.Background(), flag.Args()[1:], sources, config, os.Stdout); err != nil {
+			zap.S().Fatal(err)
+		}
+		return
+	case "doctor":
+		var dbs []*scraper.DB
+		for _, src := range sources {
+			if db, ok := src.(*scraper.DB); ok {
+				dbs = append(dbs, db)
+			}
+		}
+		if err := runDoctor(context.Background(), flag.Args()[1:], dbs, os.Stdout); err != nil {
+			zap.S().Fatal(err)
+		}
+		return
+	case "sync":
+		var scrapers []syncer
+		if kilonova != nil {
+			scrapers = append(scrapers, kilonova)
+		}
+		for _, x := range []struct {
+			enabled bool
+			sc      syncer
+		}{{*infoarenaFlag, infoarena}, {*nerdarenaFlag, nerdarena}, {*csacademyFlag, csacademy}, {*campionFlag, campion}, {*codeforcesFlag, codeforces}} {
+			if x.enabled {
+				scrapers = append(scrapers, x.sc)
+			}
+		}
+		for _, sc := range monitors {
+			scrapers = append(scrapers, sc)
+		}
+		if err := runSync(context.Background(), syncOpts, scrapers, os.Stdout); err != nil {
+			zap.S().Fatal(err)
+		}
+		return
+	default:
+		zap.S().Fatalf("Unknown command %q", flag.Arg(0))
+	}
+
+	if *metricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", scraper.DefaultMetrics)
+			if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+				zap.S().Warn("Metrics server stopped: ", err)
+			}
+		}()
+	}
+
+	if kilonova != nil {
+		if err := kilonova.ParseNewSubs(context.Background()); err != nil {
+			zap.S().Warnw("Could not scrape new submissions", "platform", kilonova.DB.PlatformName, "error", err)
+		}
+	}
+
 	if *nerdarenaFlag {
 		if err := nerdarena.ParseNewSubs(context.Background()); err != nil {
-			zap.S().Fatal(err)
+			zap.S().Warnw("Could not scrape new submissions", "platform", nerdarena.DB.PlatformName, "error", err)
 		}
 	}
 
 	if *infoarenaFlag {
 		if err := infoarena.ParseNewSubs(context.Background()); err != nil {
-			zap.S().Fatal(err)
+			zap.S().Warnw("Could not scrape new submissions", "platform", infoarena.DB.PlatformName, "error", err)
 		}
 	}
 
 	if *csacademyFlag {
 		if err := csacademy.ParseNewSubs(context.Background()); err != nil {
-			zap.S().Fatal(err)
+			zap.S().Warnw("Could not scrape new submissions", "platform", csacademy.DB.PlatformName, "error", err)
 		}
 	}
 
 	if *campionFlag {
 		if err := campion.ParseNewSubs(context.Background()); err != nil {
-			zap.S().Fatal(err)
+			zap.S().Warnw("Could not scrape new submissions", "platform", campion.DB.PlatformName, "error", err)
+		}
+	}
+
+	if *codeforcesFlag {
+		if err := codeforces.ParseNewSubs(context.Background()); err != nil {
+			zap.S().Warnw("Could not scrape new submissions", "platform", codeforces.DB.PlatformName, "error", err)
+		}
+	}
+
+	for _, sc := range monitors {
+		if err := sc.ParseNewSubs(context.Background()); err != nil {
+			zap.S().Warnw("Could not scrape new submissions", "platform", sc.DB.PlatformName, "error", err)
 		}
 	}
 
 	if *scrapeForward {
-		if !(*infoarenaFlag || *nerdarenaFlag || *csacademyFlag || *campionFlag) {
+		if !(*infoarenaFlag || *nerdarenaFlag || *csacademyFlag || *campionFlag || *codeforcesFlag || kilonova != nil || len(monitors) > 0) {
 			zap.S().Fatal("Cannot scrape forward if all fetching backends are disabled")
 		}
 		zap.S().Info("Scrape forward for extern backends. Press Ctrl+C to quit")
+		pipeline := scraper.PipelineOptions{Workers: *scrapeWorkers, Rate: *scrapeRate, QueueSize: *scrapeQueue, BatchSize: *scrapeBatch}
+		infoarena.Pipeline, nerdarena.Pipeline, csacademy.Pipeline, campion.Pipeline = pipeline, pipeline, pipeline, pipeline
+		if kilonova != nil {
+			kilonova.Pipeline = pipeline
+		}
+		for _, sc := range monitors {
+			sc.Pipeline = pipeline
+		}
 		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		// A platform failing does not stop the others. Quit once all of them are done
+		var wg sync.WaitGroup
+		if kilonova != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := kilonova.ParseBacklog(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					zap.S().Warnw("Backlog scrape failed", "platform", kilonova.DB.PlatformName, "error", err)
+				}
+			}()
+		}
 		if *infoarenaFlag {
+			wg.Add(1)
 			go func() {
-				if err := infoarena.ParseBacklog(ctx); err != nil {
-					zap.S().Warn(err)
-					stop()
+				defer wg.Done()
+				if err := infoarena.ParseBacklog(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					zap.S().Warnw("Backlog scrape failed", "platform", infoarena.DB.PlatformName, "error", err)
 				}
 			}()
 		}
 		if *nerdarenaFlag {
+			wg.Add(1)
 			go func() {
-				if err := nerdarena.ParseBacklog(ctx); err != nil {
-					zap.S().Warn(err)
-					stop()
+				defer wg.Done()
+				if err := nerdarena.ParseBacklog(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					zap.S().Warnw("Backlog scrape failed", "platform", nerdarena.DB.PlatformName, "error", err)
 				}
 			}()
 		}
 		if *csacademyFlag {
+			wg.Add(1)
 			go func() {
-				if err := csacademy.ParseBacklog(ctx); err != nil {
-					zap.S().Warn(err)
-					stop()
+				defer wg.Done()
+				if err := csacademy.ParseBacklog(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					zap.S().Warnw("Backlog scrape failed", "platform", csacademy.DB.PlatformName, "error", err)
 				}
 			}()
 		}
 		if *campionFlag {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := campion.ParseBacklog(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					zap.S().Warnw("Backlog scrape failed", "platform", campion.DB.PlatformName, "error", err)
+				}
+			}()
+		}
+		if *codeforcesFlag {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := codeforces.ParseBacklog(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					zap.S().Warnw("Backlog scrape failed", "platform", codeforces.DB.PlatformName, "error", err)
+				}
+			}()
+		}
+		for _, sc := range monitors {
+			sc := sc
+			wg.Add(1)
 			go func() {
-				if err := campion.ParseBacklog(ctx); err != nil {
-					zap.S().Warn(err)
-					stop()
+				defer wg.Done()
+				if err := sc.ParseBacklog(ctx); err != nil && !errors.Is(err, context.Canceled) {
+					zap.S().Warnw("Backlog scrape failed", "platform", sc.DB.PlatformName, "error", err)
 				}
 			}()
 		}
+		go func() {
+			wg.Wait()
+			stop()
+		}()
 
 		<-ctx.Done()
 		zap.S().Info("Closing")
+		zap.L().Sync()
 		os.Exit(0)
 	}
 
 	if *exportStats {
 		stats := []*scraper.Statistics{}
+		statsOpts := scraper.StatsOptions{
+			NumDays:          *exportDays + lookbackDays,
+			NumMonths:        *exportMonths + lookbackMonths,
+			RollInterval:     *exportRollInterval,
+			NumRollingMonths: *exportRollingMonths + lookbackRolling,
+			NumCohorts:       *exportCohorts,
+			HeatmapDays:      *exportHeatmapDays,
 
-		if *kilonovaFlag {
-			if *kilonovaDSN == "" {
-				zap.S().Fatal("Empty kilonova DSN")
-			}
-
-			knStats, err := GetKilonovaStats(context.Background(), *kilonovaDSN, *exportDays, *exportMonths, *exportRollInterval, *exportRollingMonths)
-			if err != nil {
-				zap.S().Fatal(err)
-			}
-			stats = append(stats, knStats)
-		}
-
-		if *infoarenaFlag {
-			iaStats, err := infoarena.DB.GetInfoarenaStats(context.Background(), *exportDays, *exportMonths, *exportRollInterval, *exportRollingMonths)
-			if err != nil {
-				zap.S().Fatal(err)
-			}
-			stats = append(stats, iaStats)
+			Location: loc,
+			Extra:    withLookback(extraQueries),
+			Leaderboards: scraper.LeaderboardOptions{
+				Granularity: leaderboardGran,
+				Periods:     *leaderboardPeriods,
+				TopN:        *leaderboardTop,
+			},
 		}
 
-		if *nerdarenaFlag {
-			naStats, err := nerdarena.DB.GetInfoarenaStats(context.Background(), *exportDays, *exportMonths, *exportRollInterval, *exportRollingMonths)
+		for _, src := range sources {
+			st, err := src.Statistics(context.Background(), config.StatsOptions(src.Platform(), statsOpts))
 			if err != nil {
 				zap.S().Fatal(err)
 			}
-			stats = append(stats, naStats)
+			stats = append(stats, st)
 		}
 
-		if *csacademyFlag {
-			csaStats, err := csacademy.DB.GetInfoarenaStats(context.Background(), *exportDays, *exportMonths, *exportRollInterval, *exportRollingMonths)
-			if err != nil {
-				zap.S().Fatal(err)
-			}
-			stats = append(stats, csaStats)
-		}
-
-		if *campionFlag {
-			campionStats, err := campion.DB.GetInfoarenaStats(context.Background(), *exportDays, *exportMonths, *exportRollInterval, *exportRollingMonths)
-			if err != nil {
-				zap.S().Fatal(err)
-			}
-			stats = append(stats, campionStats)
-		}
-
-		f, err := os.Create(*exportStatsPath)
-		if err != nil {
-			zap.S().Fatal(err)
-		}
-		defer f.Close()
-
-		if err := ExportToVROBody(context.Background(), &Config{
+		if err := Export(context.Background(), &Config{
 			Platforms:        stats,
 			NumDays:          *exportDays,
 			NumMonths:        *exportMonths,
 			RollingInterval:  *exportRollInterval,
 			NumRollingMonths: *exportRollingMonths,
+			NumCohorts:       *exportCohorts,
 
 			ShowWaitingDisclaimer: *infoarenaFlag || *nerdarenaFlag,
 			ShowCSADisclaimer:     *csacademyFlag,
-		}, f); err != nil {
+
+			TemplatePath: *exportTemplate,
+			Standalone:   *exportPage,
+			ShowCharts:   *exportCharts,
+			ShowVerdicts: *exportVerdicts,
+
+			ExtraQueries: extraQueries,
+			Location:     loc,
+		}, formats, *exportStatsPath); err != nil {
 			zap.S().Fatal(err)
 		}
 	}
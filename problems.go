@@ -0,0 +1,539 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+const (
+	MatchExact   = "exact"
+	MatchFuzzy   = "fuzzy"
+	MatchCurated = "curated"
+)
+
+// Names shorter than this only match exactly
+const minFuzzyNameLength = 5
+
+// ProblemRef is a problem of a platform
+type ProblemRef struct {
+	Platform string `json:"platform"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+}
+
+func (p ProblemRef) String() string {
+	if p.Name == "" || p.Name == p.ID {
+		return p.Platform + "/" + p.ID
+	}
+	return p.Platform + "/" + p.ID + " (" + p.Name + ")"
+}
+
+// ProblemMapping is the same problem across archives
+type ProblemMapping struct {
+	Name string `json:"name"`
+	// Problem IDs keyed by platform name
+	IDs map[string]string `json:"ids"`
+	// Methods the problems were matched by
+	Methods []string `json:"methods,omitempty"`
+}
+
+// String names the mapping by its name, or by its problem IDs if unnamed
+func (pm *ProblemMapping) String() string {
+	switch {
+	case pm == nil:
+		return "null"
+	case pm.Name != "":
+		return strconv.Quote(pm.Name)
+	}
+	ids := make([]string, 0, len(pm.IDs))
+	for platform, id := range pm.IDs {
+		ids = append(ids, platform+"/"+id)
+	}
+	slices.Sort(ids)
+	return "[" + strings.Join(ids, ", ") + "]"
+}
+
+// ProblemProposal is a possible match between problems of two platforms
+type ProblemProposal struct {
+	Method string `json:"method"`
+	// Similarity of the normalized names, from 0 to 1
+	Similarity float64    `json:"similarity"`
+	A          ProblemRef `json:"a"`
+	B          ProblemRef `json:"b"`
+}
+
+// ProblemTable is the problem mapping table, saved as JSON at -problems_path.
+// Curated mapping files use the same format, so they can be imported and exported as-is
+type ProblemTable struct {
+	Problems []*ProblemMapping `json:"problems"`
+
+	byRef map[[2]string]*ProblemMapping
+}
+
+// LoadProblemTable reads the mapping table at path, a missing file being an empty table
+func LoadProblemTable(path string) (*ProblemTable, error) {
+	table, err := ReadProblemTable(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &ProblemTable{}, nil
+	}
+	return table, err
+}
+
+// ReadProblemTable reads a problem mapping file, which must exist, unlike for LoadProblemTable
+func ReadProblemTable(path string) (*ProblemTable, error) {
+	var table ProblemTable
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("could not parse problem mapping file %s: %w", path, err)
+	}
+	for i, pm := range table.Problems {
+		if pm == nil || len(pm.IDs) < 2 {
+			return nil, fmt.Errorf("problem mapping file %s: entry %d (%s) must map at least 2 problems", path, i+1, pm)
+		}
+	}
+	return &table, nil
+}
+
+func (t *ProblemTable) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(t)
+}
+
+func (t *ProblemTable) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := t.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (t *ProblemTable) find(platform, id string) *ProblemMapping {
+	if t.byRef == nil {
+		t.byRef = make(map[[2]string]*ProblemMapping)
+		for _, pm := range t.Problems {
+			t.index(pm)
+		}
+	}
+	return t.byRef[[2]string{platform, id}]
+}
+
+func (t *ProblemTable) index(pm *ProblemMapping) {
+	for platform, id := range pm.IDs {
+		t.byRef[[2]string{platform, id}] = pm
+	}
+}
+
+// Mapped returns whether both problems are in the same mapping
+func (t *ProblemTable) Mapped(a, b ProblemRef) bool {
+	pm := t.find(a.Platform, a.ID)
+	return pm != nil && pm == t.find(b.Platform, b.ID)
+}
+
+// Add stores a proposal, merging the mappings of its problems.
+// It returns an error if that would map two problems of the same platform together.
+func (t *ProblemTable) Add(p ProblemProposal) error {
+	pa, pb := t.find(p.A.Platform, p.A.ID), t.find(p.B.Platform, p.B.ID)
+	switch {
+	case pa == nil && pb == nil:
+		name := p.A.Name
+		if name == "" {
+			name = p.A.ID
+		}
+		pm := &ProblemMapping{
+			Name:    name,
+			IDs:     map[string]string{p.A.Platform: p.A.ID, p.B.Platform: p.B.ID},
+			Methods: []string{p.Method},
+		}
+		t.Problems = append(t.Problems, pm)
+		t.index(pm)
+		return nil
+	case pa == nil:
+		pa, pb = pb, pa
+		p.A, p.B = p.B, p.A
+	}
+
+	if pb == nil {
+		pb = &ProblemMapping{IDs: map[string]string{p.B.Platform: p.B.ID}}
+	} else if pa == pb {
+		pa.Methods = appendMethod(pa.Methods, p.Method)
+		return nil
+	}
+	if conflicts(pa.IDs, pb.IDs) {
+		return fmt.Errorf("cannot map %s to %s: they are mapped to different problems of the same platform", p.A, p.B)
+	}
+	for platform, id := range pb.IDs {
+		pa.IDs[platform] = id
+	}
+	for _, method := range pb.Methods {
+		pa.Methods = appendMethod(pa.Methods, method)
+	}
+	pa.Methods = appendMethod(pa.Methods, p.Method)
+	t.index(pa)
+	t.Problems = slices.DeleteFunc(t.Problems, func(pm *ProblemMapping) bool { return pm == pb })
+	return nil
+}
+
+// Import merges the mappings of another table, such as a curated mapping file.
+// It returns the number of mappings which could not be merged.
+func (t *ProblemTable) Import(other *ProblemTable) int {
+	var failed int
+	for _, pm := range other.Problems {
+		if pm == nil || len(pm.IDs) < 2 {
+			zap.S().Warnf("Skipping mapping %s, it has less than 2 problems", pm)
+			failed++
+			continue
+		}
+		var refs []ProblemRef
+		for platform, id := range pm.IDs {
+			refs = append(refs, ProblemRef{Platform: platform, ID: id, Name: pm.Name})
+		}
+		slices.SortFunc(refs, func(a, b ProblemRef) int { return strings.Compare(a.Platform, b.Platform) })
+		methods := pm.Methods
+		if len(methods) == 0 {
+			methods = []string{MatchCurated}
+		}
+		for i := 1; i < len(refs); i++ {
+			for _, method := range methods {
+				if err := t.Add(ProblemProposal{Method: method, Similarity: 1, A: refs[0], B: refs[i]}); err != nil {
+					zap.S().Warn(err)
+					failed++
+					break
+				}
+			}
+		}
+		// Curated names take precedence over the ones taken from the archives
+		if mapped := t.find(refs[0].Platform, refs[0].ID); mapped != nil && pm.Name != "" {
+			mapped.Name = pm.Name
+		}
+	}
+	return failed
+}
+
+// normalizeProblemName lowercases a problem name and strips the romanian diacritics, spaces and punctuation
+func normalizeProblemName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, strings.ToLower(diacritics.Replace(name)))
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// nameSimilarity is 1 minus the edit distance of the names relative to the longer one
+func nameSimilarity(a, b []rune) float64 {
+	longest := max(len(a), len(b))
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+type namedProblem struct {
+	ref  ProblemRef
+	norm []rune
+}
+
+// uniqueProblems indexes the problems of a platform by normalized name, leaving out names shared by multiple problems
+func uniqueProblems(platform string, problems []scraper.LeaderboardEntry) map[string]namedProblem {
+	idx := make(map[string]namedProblem)
+	dup := make(map[string]bool)
+	for _, pb := range problems {
+		name := pb.Name
+		if name == "" {
+			name = pb.ID
+		}
+		norm := normalizeProblemName(name)
+		if norm == "" {
+			continue
+		}
+		if _, ok := idx[norm]; ok {
+			dup[norm] = true
+		}
+		idx[norm] = namedProblem{ref: ProblemRef{Platform: platform, ID: pb.ID, Name: pb.Name}, norm: []rune(norm)}
+	}
+	for norm := range dup {
+		delete(idx, norm)
+	}
+	return idx
+}
+
+// bestMatch returns the most similar problem of candidates, if it is at least minSimilarity and there is no tie
+func bestMatch(a namedProblem, candidates map[string]namedProblem, minSimilarity float64) (namedProblem, float64, bool) {
+	var best namedProblem
+	var bestSim float64
+	var tie bool
+	for _, b := range candidates {
+		longest := max(len(a.norm), len(b.norm))
+		if len(b.norm) < minFuzzyNameLength || float64(abs(len(a.norm)-len(b.norm))) > (1-minSimilarity)*float64(longest) {
+			continue
+		}
+		sim := nameSimilarity(a.norm, b.norm)
+		switch {
+		case sim > bestSim:
+			best, bestSim, tie = b, sim, false
+		case sim == bestSim:
+			tie = true
+		}
+	}
+	return best, bestSim, bestSim >= minSimilarity && !tie
+}
+
+// ProposeProblems matches the problems of every pair of platforms by name. The problems without an exact match are then
+// matched by similarity, if they are each other's most similar problem, at least minSimilarity alike and without ties.
+func ProposeProblems(problems map[string][]scraper.LeaderboardEntry, platforms []string, minSimilarity float64) []ProblemProposal {
+	var proposals []ProblemProposal
+	for i, pa := range platforms {
+		for _, pb := range platforms[i+1:] {
+			ia := uniqueProblems(pa, problems[pa])
+			ib := uniqueProblems(pb, problems[pb])
+			for norm, a := range ia {
+				if b, ok := ib[norm]; ok {
+					proposals = append(proposals, ProblemProposal{Method: MatchExact, Similarity: 1, A: a.ref, B: b.ref})
+					delete(ia, norm)
+					delete(ib, norm)
+				}
+			}
+			if minSimilarity >= 1 {
+				continue
+			}
+
+			for _, a := range ia {
+				if len(a.norm) < minFuzzyNameLength {
+					continue
+				}
+				b, sim, ok := bestMatch(a, ib, minSimilarity)
+				if !ok {
+					continue
+				}
+				if back, _, ok := bestMatch(b, ia, minSimilarity); !ok || back.ref != a.ref {
+					continue
+				}
+				proposals = append(proposals, ProblemProposal{Method: MatchFuzzy, Similarity: sim, A: a.ref, B: b.ref})
+			}
+		}
+	}
+
+	slices.SortFunc(proposals, func(a, b ProblemProposal) int {
+		return strings.Compare(a.A.String()+" "+a.B.String(), b.A.String()+" "+b.B.String())
+	})
+	return proposals
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// ProblemComparison is the recent activity of a mapped problem on each platform
+type ProblemComparison struct {
+	Name string `json:"name"`
+	// Activity keyed by platform name. Platforms without submissions are left out
+	Activity map[string]scraper.LeaderboardEntry `json:"activity"`
+}
+
+func (c ProblemComparison) totalSubmissions() int {
+	var total int
+	for _, act := range c.Activity {
+		total += act.Submissions
+	}
+	return total
+}
+
+// CompareProblems lines up the activity of the mapped problems, most submitted first
+func CompareProblems(table *ProblemTable, problems map[string][]scraper.LeaderboardEntry) []ProblemComparison {
+	activity := make(map[[2]string]scraper.LeaderboardEntry)
+	for platform, list := range problems {
+		for _, pb := range list {
+			activity[[2]string{platform, pb.ID}] = pb
+		}
+	}
+
+	comparisons := make([]ProblemComparison, 0, len(table.Problems))
+	for _, pm := range table.Problems {
+		cmp := ProblemComparison{Name: pm.Name, Activity: make(map[string]scraper.LeaderboardEntry)}
+		for platform, id := range pm.IDs {
+			if act, ok := activity[[2]string{platform, id}]; ok {
+				cmp.Activity[platform] = act
+			}
+		}
+		comparisons = append(comparisons, cmp)
+	}
+	slices.SortStableFunc(comparisons, func(a, b ProblemComparison) int {
+		if ta, tb := a.totalSubmissions(), b.totalSubmissions(); ta != tb {
+			return tb - ta
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return comparisons
+}
+
+func writeProblemProposals(w io.Writer, proposals []ProblemProposal, output string) error {
+	if output == OutputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(proposals)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tSIMILARITY\tPROBLEM\tPROBLEM")
+	for _, p := range proposals {
+		fmt.Fprintf(tw, "%s\t%.2f\t%s\t%s\n", p.Method, p.Similarity, p.A, p.B)
+	}
+	return tw.Flush()
+}
+
+func writeProblemComparisons(w io.Writer, comparisons []ProblemComparison, platforms []string, output string) error {
+	if output == OutputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(comparisons)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "PROBLEM")
+	for _, platform := range platforms {
+		fmt.Fprintf(tw, "\t%s (SUBS/USERS/SOLVED)", strings.ToUpper(platform))
+	}
+	fmt.Fprintln(tw)
+	for _, cmp := range comparisons {
+		fmt.Fprint(tw, cmp.Name)
+		for _, platform := range platforms {
+			act, ok := cmp.Activity[platform]
+			if !ok {
+				fmt.Fprint(tw, "\t-")
+				continue
+			}
+			fmt.Fprintf(tw, "\t%d/%d/%d", act.Submissions, act.Attempted, act.Solved)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// runProblems runs the problems subcommand: propose, seed, import FILE, export [FILE] or compare
+func runProblems(ctx context.Context, args []string, sources []scraper.StatsSource, config *FileConfig, w io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing problems command (propose, seed, import, export or compare)")
+	}
+	switch *output {
+	case OutputTable, OutputJSON:
+	default:
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	table, err := LoadProblemTable(*problemsPath)
+	if err != nil {
+		return err
+	}
+
+	// loadProblems lists the activity of every problem of the platforms in [from, to)
+	loadProblems := func(from, to time.Time) ([]string, map[string][]scraper.LeaderboardEntry, error) {
+		var platforms []string
+		problems := make(map[string][]scraper.LeaderboardEntry)
+		for _, src := range sources {
+			list, err := src.ProblemActivity(ctx, from, to, config.Platform(src.Platform()).Exclude)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not list %s problems: %w", src.Platform(), err)
+			}
+			platforms = append(platforms, src.Platform())
+			problems[src.Platform()] = list
+		}
+		return platforms, problems, nil
+	}
+
+	switch args[0] {
+	case "propose", "seed":
+		platforms, problems, err := loadProblems(time.Time{}, time.Now().AddDate(1, 0, 0))
+		if err != nil {
+			return err
+		}
+		var proposals []ProblemProposal
+		for _, p := range ProposeProblems(problems, platforms, *problemSimilarity) {
+			if !table.Mapped(p.A, p.B) {
+				proposals = append(proposals, p)
+			}
+		}
+		if args[0] == "propose" {
+			return writeProblemProposals(w, proposals, *output)
+		}
+
+		var added []ProblemProposal
+		for _, p := range proposals {
+			if err := table.Add(p); err != nil {
+				zap.S().Warn(err)
+				continue
+			}
+			added = append(added, p)
+		}
+		if err := table.Save(*problemsPath); err != nil {
+			return err
+		}
+		return writeProblemProposals(w, added, *output)
+	case "import":
+		if len(args) < 2 {
+			return fmt.Errorf("missing mapping file to import")
+		}
+		other, err := ReadProblemTable(args[1])
+		if err != nil {
+			return err
+		}
+		if failed := table.Import(other); failed > 0 {
+			zap.S().Warnf("Could not import %d mappings", failed)
+		}
+		return table.Save(*problemsPath)
+	case "export":
+		if len(args) < 2 {
+			return table.Write(w)
+		}
+		return table.Save(args[1])
+	case "compare":
+		to := time.Now()
+		platforms, problems, err := loadProblems(to.AddDate(0, 0, -*problemDays), to)
+		if err != nil {
+			return err
+		}
+		return writeProblemComparisons(w, CompareProblems(table, problems), platforms, *output)
+	}
+	return fmt.Errorf("unknown problems command %q", args[0])
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProblemTableImportIncomplete(t *testing.T) {
+	other := &ProblemTable{Problems: []*ProblemMapping{
+		{Name: "none"},
+		{Name: "one", IDs: map[string]string{"infoarena": "adunare"}},
+		{Name: "Adunare", IDs: map[string]string{"infoarena": "adunare", "kilonova": "1"}},
+	}}
+	var table ProblemTable
+	if failed := table.Import(other); failed != 2 {
+		t.Errorf("got %d failed mappings, want 2", failed)
+	}
+	if len(table.Problems) != 1 || table.Problems[0].Name != "Adunare" {
+		t.Fatalf("got mappings %v, want only Adunare", table.Problems)
+	}
+	if !table.Mapped(ProblemRef{Platform: "infoarena", ID: "adunare"}, ProblemRef{Platform: "kilonova", ID: "1"}) {
+		t.Error("adunare is not mapped to kilonova/1")
+	}
+}
+
+func TestReadProblemTableIncomplete(t *testing.T) {
+	for name, data := range map[string]string{
+		"no ids":  `{"problems": [{"name": "none"}]}`,
+		"one id":  `{"problems": [{"ids": {"kilonova": "1"}}]}`,
+		"null":    `{"problems": [null]}`,
+		"correct": `{"problems": [{"name": "Adunare", "ids": {"infoarena": "adunare", "kilonova": "1"}}]}`,
+	} {
+		path := filepath.Join(t.TempDir(), "problems.json")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ReadProblemTable(path)
+		switch {
+		case name == "correct" && err != nil:
+			t.Errorf("%s: %v", name, err)
+		case name != "correct" && (err == nil || !strings.Contains(err.Error(), "entry 1")):
+			t.Errorf("%s: got error %v, want one naming entry 1", name, err)
+		}
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -16,6 +20,8 @@ type Submission struct {
 
 	Username    string
 	DisplayName string
+	// ID of the user on platforms that have both, which exclusions may also match. nil if unknown
+	UserID *string
 
 	ProblemID   *string
 	ProblemName *string
@@ -33,9 +39,9 @@ type Submission struct {
 
 func InsertSubmission(ctx context.Context, execer sqlx.ExecerContext, sub *Submission) (bool, error) {
 	_, err := execer.ExecContext(ctx,
-		`INSERT INTO submissions (id, username, display_name, problem_id, problem_name, size_kb, date, ignored, compile_error, internal_error, score) 
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		sub.ID, sub.Username, sub.DisplayName, sub.ProblemID, sub.ProblemName, sub.SizeKB, sub.Date, sub.Ignored, sub.CompileError, sub.InternalError, sub.Score,
+		`INSERT INTO submissions (id, username, display_name, user_id, problem_id, problem_name, size_kb, date, ignored, compile_error, internal_error, score) 
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sub.ID, sub.Username, sub.DisplayName, sub.UserID, sub.ProblemID, sub.ProblemName, sub.SizeKB, sub.Date, sub.Ignored, sub.CompileError, sub.InternalError, sub.Score,
 	)
 	if err != nil {
 		var err2 sqlite3.Error
@@ -43,9 +49,9 @@ func InsertSubmission(ctx context.Context, execer sqlx.ExecerContext, sub *Submi
 			if err2.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
 				// Still do insert or replace (to make sure up to date) but mark as having already inserted
 				execer.ExecContext(ctx,
-					`INSERT OR REPLACE INTO submissions (id, username, display_name, problem_id, problem_name, size_kb, date, ignored, compile_error, internal_error, score) 
-						VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-					sub.ID, sub.Username, sub.DisplayName, sub.ProblemID, sub.ProblemName, sub.SizeKB, sub.Date, sub.Ignored, sub.CompileError, sub.InternalError, sub.Score,
+					`INSERT OR REPLACE INTO submissions (id, username, display_name, user_id, problem_id, problem_name, size_kb, date, ignored, compile_error, internal_error, score) 
+						VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+					sub.ID, sub.Username, sub.DisplayName, sub.UserID, sub.ProblemID, sub.ProblemName, sub.SizeKB, sub.Date, sub.Ignored, sub.CompileError, sub.InternalError, sub.Score,
 				)
 				return false, nil
 			}
@@ -55,10 +61,126 @@ func InsertSubmission(ctx context.Context, execer sqlx.ExecerContext, sub *Submi
 	return true, err
 }
 
+const sqliteDriver = "sqlite3_stats"
+
+func init() {
+	// Registers the go helper functions used by the stats queries
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("regexp", sqliteRegexp, true); err != nil {
+				return err
+			}
+			if err := conn.RegisterAggregator("median", newMedianAggregator, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("period_start", sqlitePeriodStart, true)
+		},
+	})
+}
+
+var locations sync.Map
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// sqlitePeriodStart returns the unix timestamp of the start of the period containing ts, bucketed in the given timezone
+func sqlitePeriodStart(ts int64, unit string, days int64, anchor int64, tz string) (int64, error) {
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return 0, err
+	}
+	g := Granularity{Unit: Unit(unit), Days: int(days)}
+	return g.Truncate(time.Unix(ts, 0).In(loc), time.Unix(anchor, 0).In(loc)).Unix(), nil
+}
+
+// sqliteDialect writes the stats queries for the scraped submission dumps
+type sqliteDialect struct{}
+
+func (sqliteDialect) Columns() SubmissionColumns {
+	return SubmissionColumns{
+		Table:         "submissions",
+		User:          "username",
+		Problem:       "problem_id",
+		Date:          "unixepoch(date)",
+		Score:         "score",
+		CompileError:  "compile_error",
+		InternalError: "internal_error",
+	}
+}
+
+func (sqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (sqliteDialect) Time(t time.Time) any {
+	return t.Unix()
+}
+
+func (sqliteDialect) PeriodStart(args *QueryArgs, g Granularity, date string, anchor time.Time, loc *time.Location) string {
+	return "period_start(" + date + ", " + args.Add(string(g.Unit)) + ", " + args.Add(g.Days) + ", " + args.Add(anchor.Unix()) + ", " + args.Add(loc.String()) + ")"
+}
+
+func (sqliteDialect) Median(expr string) string {
+	return "median(" + expr + ")"
+}
+
+func (sqliteDialect) Pair() string {
+	return "user_id || '###' || problem_id"
+}
+
+func (sqliteDialect) Exclusions(args *QueryArgs, e *Exclusions) string {
+	cond, condArgs := sqliteExclusionsCond(e)
+	args.Args = append(args.Args, condArgs...)
+	return cond
+}
+
+// medianAggregator implements the median aggregate function for SQLite, ignoring NULLs.
+// Like PERCENTILE_CONT(0.5) in Postgres, an even count averages the two middle values
+type medianAggregator struct {
+	vals []float64
+}
+
+func newMedianAggregator() *medianAggregator {
+	return &medianAggregator{}
+}
+
+func (m *medianAggregator) Step(val any) {
+	switch v := val.(type) {
+	case int64:
+		m.vals = append(m.vals, float64(v))
+	case float64:
+		m.vals = append(m.vals, v)
+	}
+}
+
+func (m *medianAggregator) Done() any {
+	if len(m.vals) == 0 {
+		return nil
+	}
+	slices.Sort(m.vals)
+	mid := len(m.vals) / 2
+	if len(m.vals)%2 == 1 {
+		return m.vals[mid]
+	}
+	return (m.vals[mid-1] + m.vals[mid]) / 2
+}
+
 type DB struct {
 	db *sqlx.DB
 
 	PlatformName string
+
+	// Builds the link to a problem of the platform. nil if the parser cannot link to problems
+	ProblemURL func(problemID string) string
 }
 
 func (s *DB) InsertMonitorPage(ctx context.Context, subs []*Submission) (int, error) {
@@ -67,23 +189,31 @@ func (s *DB) InsertMonitorPage(ctx context.Context, subs []*Submission) (int, er
 		return 0, err
 	}
 	defer tx.Rollback()
-	var numInserted int
+	var numInserted, numUpdated, numSkipped int
 	for _, sub := range subs {
 		if !sub.Handled {
+			numSkipped++
 			continue
 		}
 		ok, err := InsertSubmission(ctx, tx, sub)
 		if err != nil {
-			zap.S().Warn(err)
+			zap.S().Warnw("Could not insert submission", "platform", s.PlatformName, "submission_id", sub.ID, "error", err)
+			DefaultMetrics.ObserveError(s.PlatformName, ErrorClassInsert)
+			numSkipped++
 			continue
 		}
 		if ok {
 			numInserted++
+		} else {
+			numUpdated++
 		}
+		DefaultMetrics.ObserveSubmission(s.PlatformName, sub.Date)
 	}
 	if err := tx.Commit(); err != nil {
+		DefaultMetrics.ObserveError(s.PlatformName, ErrorClassInsert)
 		return 0, err
 	}
+	DefaultMetrics.ObserveRows(s.PlatformName, numInserted, numUpdated, numSkipped)
 	return numInserted, nil
 }
 
@@ -93,23 +223,49 @@ func (s *DB) CountSubmissions(ctx context.Context) (int, error) {
 	return cnt, err
 }
 
+// CountUserSubmissions counts the submissions of a user, ignoring the case of the username
+func (s *DB) CountUserSubmissions(ctx context.Context, username string) (int, error) {
+	var cnt int
+	err := s.db.GetContext(ctx, &cnt, "SELECT COUNT(*) FROM submissions WHERE username = ? COLLATE NOCASE", username)
+	return cnt, err
+}
+
 func (s *DB) SubmissionExists(ctx context.Context, id int) (bool, error) {
 	var cnt int
 	err := s.db.GetContext(ctx, &cnt, "SELECT COUNT(*) FROM submissions WHERE id = ?", id)
 	return cnt > 0, err
 }
 
+// ReadOnly makes NewDB open the dumps without creating or migrating them, so that dry runs write nothing
+var ReadOnly bool
+
 func NewDB(platformName string, dbname string) (*DB, error) {
-	d, err := sqlx.Connect("sqlite3", dbname)
+	if !ReadOnly {
+		return openDB(platformName, dbname, true)
+	}
+	if _, err := os.Stat(dbname); errors.Is(err, os.ErrNotExist) {
+		// Nothing is stored yet, so an empty dump in memory stands in for it
+		return openDB(platformName, "file:"+dbname+"?mode=memory&cache=shared", true)
+	}
+	return openDB(platformName, "file:"+dbname+"?mode=ro", false)
+}
+
+// openDB connects to a dump, creating its table and adding the missing columns if migrate is set
+func openDB(platformName string, dsn string, migrate bool) (*DB, error) {
+	d, err := sqlx.Connect(sqliteDriver, dsn)
 	if err != nil {
 		return nil, err
 	}
+	if !migrate {
+		return &DB{db: d, PlatformName: platformName}, nil
+	}
 	if _, err := d.Exec(`
 CREATE TABLE IF NOT EXISTS submissions (
 	id   INTEGER PRIMARY KEY,
 
 	username TEXT NOT NULL,
 	display_name TEXT NOT NULL,
+	user_id TEXT,
 
 	problem_id TEXT,
 	problem_name TEXT,
@@ -125,6 +281,16 @@ CREATE TABLE IF NOT EXISTS submissions (
 `); err != nil {
 		return nil, err
 	}
+	// Dumps created before user IDs were stored get the column, filled in when their submissions are scraped again
+	var hasUserID bool
+	if err := d.Get(&hasUserID, "SELECT COUNT(*) > 0 FROM pragma_table_info('submissions') WHERE name = 'user_id'"); err != nil {
+		return nil, err
+	}
+	if !hasUserID {
+		if _, err := d.Exec("ALTER TABLE submissions ADD COLUMN user_id TEXT"); err != nil {
+			return nil, err
+		}
+	}
 
 	return &DB{db: d, PlatformName: platformName}, nil
 }
@@ -135,8 +301,8 @@ type StatsRow struct {
 	// Trimmed down to yyyy-mm-dd, no hours/minutes
 	Time time.Time `json:"time"`
 
-	SQLiteTime *string `json:"-" db:"sqlite_time"`
-	SQLiteVar  any     `json:"" db:"var"`
+	// Unix timestamp of the period start, as returned by the stats queries
+	Period int64 `json:"-" db:"period"`
 
 	// Number of total submissions
 	NumSubmissions int `json:"num_subs" db:"num_submissions"`
@@ -148,6 +314,80 @@ type StatsRow struct {
 	UniqueUsers int `json:"unique_users" db:"unique_users"`
 	// Number of unique problems
 	UniqueProblems int `json:"unique_pbs" db:"unique_problems"`
+
+	// Verdict breakdown
+
+	// Number of submissions with a score of 100
+	FullScore int `json:"full_score" db:"full_score"`
+	// Number of submissions which failed to compile
+	CompileErrors int `json:"compile_errors" db:"compile_errors"`
+	// Number of submissions with an internal (system or problem configuration) error
+	InternalErrors int `json:"internal_errors" db:"internal_errors"`
+	// Mean and median score of the scored submissions. nil if no submission was scored
+	MeanScore   *float64 `json:"mean_score" db:"mean_score"`
+	MedianScore *float64 `json:"median_score" db:"median_score"`
+	// Number of unique (user, problem) pairs with a 100 point submission
+	SolvedPairs int `json:"solved_pairs" db:"solved_pairs"`
+
+	// Shares of NumSubmissions, from 0 to 1. Filled in by ComputeRates
+	FullScoreRate     float64 `json:"full_score_rate" db:"-"`
+	CompileErrorRate  float64 `json:"compile_error_rate" db:"-"`
+	InternalErrorRate float64 `json:"internal_error_rate" db:"-"`
+
+	// Trend data, filled in when the statistics are exported.
+
+	// Change versus the previous period. nil if the previous period is outside the queried range
+	Delta *StatsDelta `json:"delta,omitempty" db:"-"`
+	// Change versus the same month of the previous year. Only for calendar month stats
+	YearOverYear *StatsDelta `json:"year_over_year,omitempty" db:"-"`
+	// Average daily submission count over the 7 days ending with this one. Only for day stats
+	MovingAvg7 *float64 `json:"moving_avg_7,omitempty" db:"-"`
+
+	// User retention, filled in by ApplyUserActivity.
+
+	// Users whose first submission on the platform is in this period
+	NewUsers int `json:"new_users" db:"-"`
+	// Users who had submitted before this period
+	ReturningUsers int `json:"returning_users" db:"-"`
+	// Users active in the previous period who did not submit in this one. nil if the previous period is outside the queried range
+	ChurnedUsers *int `json:"churned_users" db:"-"`
+
+	// Distinct users over the trailing 7 and 30 days (including this one), and UniqueUsers/MonthlyActiveUsers. Only for day stats
+	WeeklyActiveUsers  *int     `json:"wau,omitempty" db:"-"`
+	MonthlyActiveUsers *int     `json:"mau,omitempty" db:"-"`
+	Stickiness         *float64 `json:"dau_mau,omitempty" db:"-"`
+}
+
+// ComputeRates fills in the verdict shares from the counts
+func (r *StatsRow) ComputeRates() {
+	if r.NumSubmissions == 0 {
+		return
+	}
+	total := float64(r.NumSubmissions)
+	r.FullScoreRate = float64(r.FullScore) / total
+	r.CompileErrorRate = float64(r.CompileErrors) / total
+	r.InternalErrorRate = float64(r.InternalErrors) / total
+}
+
+// StatsDelta is the difference between the metrics of two StatsRows (newer minus older)
+type StatsDelta struct {
+	NumSubmissions    int `json:"num_subs"`
+	ExcludingMultiple int `json:"excluding_multiple"`
+	UniqueUsers       int `json:"unique_users"`
+	UniqueProblems    int `json:"unique_pbs"`
+}
+
+// DeltaFrom computes the change from an older row. A nil row counts as a period with no activity
+func (r *StatsRow) DeltaFrom(older *StatsRow) *StatsDelta {
+	if older == nil {
+		older = &StatsRow{}
+	}
+	return &StatsDelta{
+		NumSubmissions:    r.NumSubmissions - older.NumSubmissions,
+		ExcludingMultiple: r.ExcludingMultiple - older.ExcludingMultiple,
+		UniqueUsers:       r.UniqueUsers - older.UniqueUsers,
+		UniqueProblems:    r.UniqueProblems - older.UniqueProblems,
+	}
 }
 
 type Statistics struct {
@@ -160,6 +400,30 @@ type Statistics struct {
 	RollingMonthsStats []*StatsRow `json:"rolling_month_stats"`
 
 	MonthsStats []*StatsRow `json:"month_stats"`
+
+	// Statistics for additionally requested granularities
+	ExtraStats []*PeriodStats `json:"extra_stats,omitempty"`
+
+	// Number of submissions left out by each exclusion rule
+	Excluded []ExcludedCount `json:"excluded,omitempty"`
+
+	// Retention of the users first seen in each of the last calendar months, newest first
+	Cohorts []Cohort `json:"cohorts,omitempty"`
+
+	// Top problems and users, newest period first
+	Leaderboards []*Leaderboard `json:"leaderboards,omitempty"`
+
+	// Submissions by day of week and hour of day
+	Heatmap *Heatmap `json:"heatmap,omitempty"`
+}
+
+// PeriodStats holds the statistics of an arbitrary granularity and range
+type PeriodStats struct {
+	Granularity Granularity `json:"granularity"`
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+
+	Rows []*StatsRow `json:"rows"`
 }
 
 func (s *DB) GetFurthestTime(ctx context.Context) (*time.Time, error) {
@@ -172,76 +436,80 @@ func (s *DB) GetFurthestTime(ctx context.Context) (*time.Time, error) {
 	}
 	tt, err := time.ParseInLocation(time.DateTime, t.String, time.UTC)
 	if err != nil {
-		panic(err)
+		return nil, ParseError(fmt.Errorf("furthest date %q: %w", t.String, err))
 	}
 	return &tt, nil
 }
 
-func (s *DB) getStats(ctx context.Context, query string, args ...any) ([]*StatsRow, error) {
-	var stats []*StatsRow
-	if err := s.db.SelectContext(ctx, &stats, query, args...); err != nil {
+// engine computes the statistics of the dump
+func (s *DB) engine() *StatsEngine {
+	return &StatsEngine{Platform: s.PlatformName, Dialect: sqliteDialect{}, DB: s.db}
+}
+
+// GetStats computes the statistics for every period of the query's granularity
+func (s *DB) GetStats(ctx context.Context, q StatsQuery) ([]*StatsRow, error) {
+	return s.engine().Stats(ctx, q)
+}
+
+func (s *DB) GetInfoarenaStats(ctx context.Context, opts StatsOptions) (*Statistics, error) {
+	dayQuery, monthQuery, rollingQuery := opts.Queries()
+	dayStats, err := s.GetStats(ctx, dayQuery)
+	if err != nil {
 		return nil, err
 	}
 
-	for i := range stats {
-		t, err := time.ParseInLocation(time.DateOnly, *stats[i].SQLiteTime, time.UTC)
-		if err != nil {
-			panic(err)
-		}
-		stats[i].PlatformName = s.PlatformName
-		stats[i].Time = t
-		stats[i].SQLiteTime = nil
-	}
-	return stats, nil
-}
-
-func (s *DB) GetInfoarenaStats(ctx context.Context, numDays, numMonths, rollInterval, numRollingMonths int) (*Statistics, error) {
-	dayStats, err := s.getStats(ctx, `
-	WITH starting_data AS (
-		SELECT username, problem_id, DATE(subs.date, 'utc') AS day FROM submissions subs
-	   ) SELECT 
-	   		COUNT(*) AS num_submissions, 
-			COUNT(DISTINCT username || '###' || problem_id) AS excluding_multiple, 
-			COUNT(DISTINCT username) AS unique_users, 
-			COUNT(DISTINCT problem_id) AS unique_problems, 
-			day AS sqlite_time
-		FROM starting_data GROUP BY day ORDER BY day DESC 
-		LIMIT ?`, numDays)
+	monthStats, err := s.GetStats(ctx, monthQuery)
 	if err != nil {
 		return nil, err
 	}
 
-	monthStats, err := s.getStats(ctx, `	
-	WITH starting_data AS (
-		SELECT username, problem_id, DATE(subs.date, 'utc', 'start of month') AS day FROM submissions subs
-	   ) SELECT 
-	   		COUNT(*) AS num_submissions, 
-			COUNT(DISTINCT username || '###' || problem_id) AS excluding_multiple, 
-			COUNT(DISTINCT username) AS unique_users, 
-			COUNT(DISTINCT problem_id) AS unique_problems, 
-			day AS sqlite_time
-		FROM starting_data GROUP BY day ORDER BY day DESC 
-		LIMIT ?`, numMonths)
+	rollingMonthStats, err := s.GetStats(ctx, rollingQuery)
 	if err != nil {
 		return nil, err
 	}
 
-	rollingMonthStats, err := s.getStats(ctx, `	
-	WITH starting_data AS (
-		SELECT username, problem_id, DATE(subs.date, 'utc') AS day FROM submissions subs
-	   ) SELECT 
-	   		COUNT(*) AS num_submissions, 
-			COUNT(DISTINCT username || '###' || problem_id) AS excluding_multiple, 
-			COUNT(DISTINCT username) AS unique_users, 
-			COUNT(DISTINCT problem_id) AS unique_problems, 
-			MIN(day) AS sqlite_time,
-			(unixepoch(DATE('now', 'utc')) - unixepoch(day)) / (86400 * ?) AS var
-		FROM starting_data GROUP BY var ORDER BY day DESC 
-		LIMIT ?`, rollInterval, numRollingMonths)
+	var extraStats []*PeriodStats
+	for _, q := range opts.Extra {
+		q.Exclude = opts.Exclude
+		rows, err := s.GetStats(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		from, to := q.Range(time.Now())
+		extraStats = append(extraStats, &PeriodStats{Granularity: q.Granularity, From: from, To: to, Rows: rows})
+	}
+
+	excluded, err := s.ExcludedCounts(ctx, opts.Exclude)
 	if err != nil {
 		return nil, err
 	}
 
+	var cohorts []Cohort
+	if opts.NumCohorts > 0 {
+		cohorts, err = s.Cohorts(ctx, opts.NumCohorts, opts.Location, opts.Exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var leaderboards []*Leaderboard
+	if opts.Leaderboards.TopN > 0 {
+		leaderboards, err = s.Leaderboards(ctx, opts.Leaderboards, opts.Location, opts.Exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var heatmap *Heatmap
+	if opts.HeatmapDays > 0 {
+		q := HeatmapQuery(opts.HeatmapDays, opts.Location, opts.Exclude)
+		rows, err := s.GetStats(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		heatmap = HeatmapFromHourly(q, rows)
+	}
+
 	var lastTime int64
 	if err := s.db.GetContext(ctx, &lastTime, "SELECT MAX(unixepoch(date)) FROM submissions"); err != nil {
 		return nil, err
@@ -255,5 +523,11 @@ func (s *DB) GetInfoarenaStats(ctx context.Context, numDays, numMonths, rollInte
 		DayStats:           dayStats,
 		RollingMonthsStats: rollingMonthStats,
 		MonthsStats:        monthStats,
+		ExtraStats:         extraStats,
+
+		Excluded:     excluded,
+		Cohorts:      cohorts,
+		Leaderboards: leaderboards,
+		Heatmap:      heatmap,
 	}, nil
 }
@@ -0,0 +1,345 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.uber.org/zap"
+)
+
+// MonitorConfig describes a monitor page that lists submissions in an HTML table, such as the ones of Infoarena or Campion.
+// See config.example.json
+type MonitorConfig struct {
+	// Address of a monitor page. {offset} is replaced with the number of newer submissions and {page} with the page number, starting at 1
+	URL string `json:"url"`
+	// Number of submissions on a page
+	PageSize int `json:"page_size"`
+	// CSS selector of the submission rows. Their child elements are the cells
+	RowSelector string         `json:"row_selector"`
+	Columns     MonitorColumns `json:"columns"`
+
+	// Go time layout of the dates, after the replacements are made and the month names are translated
+	DateFormat string `json:"date_format"`
+	// Language of the month names, translated to English before parsing. Either "en" (the default) or "ro"
+	DateLocale string `json:"date_locale"`
+	// Replacements made in the dates before translating the month names, such as {". 20": " "}
+	DateReplacements map[string]string `json:"date_replacements"`
+	// Timezone of the dates, defaults to UTC
+	Timezone string `json:"timezone"`
+
+	// Flags set on submissions whose status contains a string. Every matching rule applies
+	StatusRules []StatusRule `json:"status_rules"`
+
+	// Address of a problem, where {id} is replaced with the problem ID. Problems are not linked if empty
+	ProblemURL string `json:"problem_url"`
+}
+
+// MonitorColumns maps the fields of a submission to the cells they are read from. ID, username and date are required
+type MonitorColumns struct {
+	ID          *MonitorColumn `json:"id"`
+	Username    *MonitorColumn `json:"username"`
+	DisplayName *MonitorColumn `json:"display_name"`
+	ProblemID   *MonitorColumn `json:"problem_id"`
+	ProblemName *MonitorColumn `json:"problem_name"`
+	// Source size in kilobytes
+	Size   *MonitorColumn `json:"size_kb"`
+	Date   *MonitorColumn `json:"date"`
+	Status *MonitorColumn `json:"status"`
+	Score  *MonitorColumn `json:"score"`
+}
+
+// MonitorColumn reads a value from a cell of a row
+type MonitorColumn struct {
+	// Position of the cell in the row, starting at 0
+	Cell int `json:"cell"`
+	// CSS selector of an element in the cell. The cell itself is used if empty
+	Selector string `json:"selector"`
+	// Attribute of the element to read, such as href. The text is read if empty
+	Attr string `json:"attr"`
+	// Regular expression matched against the value, keeping its first group (or the whole match without groups)
+	Pattern string `json:"pattern"`
+}
+
+// StatusRule sets flags on the submissions whose status contains a string
+type StatusRule struct {
+	Contains string `json:"contains"`
+
+	// Not evaluated yet, such as waiting in the queue
+	Pending       bool `json:"pending"`
+	Ignored       bool `json:"ignored"`
+	CompileError  bool `json:"compile_error"`
+	InternalError bool `json:"internal_error"`
+	// The submission has no score, even if the score column has a number
+	NoScore bool `json:"no_score"`
+}
+
+// Month names translated to English for each date locale
+var dateLocales = map[string]map[string]string{
+	"en": {},
+	"ro": {
+		"ianuarie": "January", "februarie": "February", "martie": "March", "aprilie": "April",
+		"mai": "May", "iunie": "June", "iulie": "July", "august": "August",
+		"septembrie": "September", "octombrie": "October", "noiembrie": "November", "decembrie": "December",
+		"ian": "January", "feb": "February", "mar": "March", "apr": "April",
+		"iun": "June", "iul": "July", "aug": "August", "sept": "September", "sep": "September",
+		"oct": "October", "nov": "November", "dec": "December",
+	},
+}
+
+type monitorColumn struct {
+	MonitorColumn
+	re *regexp.Regexp
+}
+
+// value reads the column from the cells of a row. ok is false if the cell or the element is missing, or the pattern does not match
+func (c *monitorColumn) value(cells *goquery.Selection) (val string, ok bool) {
+	if c == nil || c.Cell >= cells.Length() {
+		return "", false
+	}
+	sel := cells.Eq(c.Cell)
+	if c.Selector != "" {
+		sel = sel.Find(c.Selector).First()
+		if sel.Length() == 0 {
+			return "", false
+		}
+	}
+	if c.Attr != "" {
+		val, ok = sel.Attr(c.Attr)
+		if !ok {
+			return "", false
+		}
+	} else {
+		val = sel.Text()
+	}
+	val = strings.TrimSpace(val)
+	if c.re != nil {
+		match := c.re.FindStringSubmatch(val)
+		if match == nil {
+			return "", false
+		}
+		val = strings.TrimSpace(match[min(len(match)-1, 1)])
+	}
+	return val, true
+}
+
+// DeclarativeParser scrapes a monitor page described by a MonitorConfig
+type DeclarativeParser struct {
+	conf MonitorConfig
+
+	id, username, displayName, problemID, problemName, size, date, status, score *monitorColumn
+
+	location *time.Location
+	// Make the date replacements and translate the month names
+	dateReplacer, monthReplacer *strings.Replacer
+}
+
+// newReplacer replaces the longest strings first, so that full month names are not replaced by their abbreviations
+func newReplacer(words map[string]string) *strings.Replacer {
+	keys := make([]string, 0, len(words))
+	for k := range words {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if len(a) != len(b) {
+			return cmp.Compare(len(b), len(a))
+		}
+		return strings.Compare(a, b)
+	})
+	var oldnew []string
+	for _, k := range keys {
+		oldnew = append(oldnew, k, words[k])
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+var _ PagedParser[int] = &DeclarativeParser{}
+
+// NewDeclarativeParser checks the config of a monitor page and returns its parser
+func NewDeclarativeParser(conf MonitorConfig) (*DeclarativeParser, error) {
+	switch {
+	case !strings.Contains(conf.URL, "{offset}") && !strings.Contains(conf.URL, "{page}"):
+		return nil, errors.New("url must contain {offset} or {page}")
+	case conf.PageSize <= 0:
+		return nil, errors.New("page_size must be positive")
+	case conf.RowSelector == "":
+		return nil, errors.New("empty row_selector")
+	case conf.DateFormat == "":
+		return nil, errors.New("empty date_format")
+	case conf.Columns.ID == nil || conf.Columns.Username == nil || conf.Columns.Date == nil:
+		return nil, errors.New("the id, username and date columns are required")
+	}
+	p := &DeclarativeParser{conf: conf, location: time.UTC}
+
+	if conf.Timezone != "" {
+		loc, err := time.LoadLocation(conf.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		p.location = loc
+	}
+
+	if conf.DateLocale == "" {
+		conf.DateLocale = "en"
+	}
+	locale, ok := dateLocales[conf.DateLocale]
+	if !ok {
+		return nil, fmt.Errorf("unknown date_locale %q", conf.DateLocale)
+	}
+	p.dateReplacer = newReplacer(conf.DateReplacements)
+	p.monthReplacer = newReplacer(locale)
+
+	for _, col := range []struct {
+		name string
+		conf *MonitorColumn
+		dest **monitorColumn
+	}{
+		{"id", conf.Columns.ID, &p.id},
+		{"username", conf.Columns.Username, &p.username},
+		{"display_name", conf.Columns.DisplayName, &p.displayName},
+		{"problem_id", conf.Columns.ProblemID, &p.problemID},
+		{"problem_name", conf.Columns.ProblemName, &p.problemName},
+		{"size_kb", conf.Columns.Size, &p.size},
+		{"date", conf.Columns.Date, &p.date},
+		{"status", conf.Columns.Status, &p.status},
+		{"score", conf.Columns.Score, &p.score},
+	} {
+		if col.conf == nil {
+			continue
+		}
+		if col.conf.Cell < 0 {
+			return nil, fmt.Errorf("column %s: negative cell", col.name)
+		}
+		c := &monitorColumn{MonitorColumn: *col.conf}
+		if c.Pattern != "" {
+			re, err := regexp.Compile(c.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: invalid pattern %q: %w", col.name, c.Pattern, err)
+			}
+			c.re = re
+		}
+		*col.dest = c
+	}
+	return p, nil
+}
+
+func (p *DeclarativeParser) parseSubmission(row *goquery.Selection) (*Submission, error) {
+	cells := row.Children()
+	sub := &Submission{Handled: true}
+
+	idText, _ := p.id.value(cells)
+	id, err := strconv.Atoi(strings.TrimPrefix(idText, "#"))
+	if err != nil {
+		return nil, ParseError(fmt.Errorf("invalid submission ID %q", idText))
+	}
+	sub.ID = id
+
+	sub.Username, _ = p.username.value(cells)
+	if sub.Username == "" {
+		return nil, ParseError(fmt.Errorf("submission %d has no username", sub.ID))
+	}
+	sub.DisplayName, _ = p.displayName.value(cells)
+	if sub.DisplayName == "" {
+		sub.DisplayName = sub.Username
+	}
+	if val, ok := p.problemID.value(cells); ok && val != "" {
+		sub.ProblemID = &val
+	}
+	if val, ok := p.problemName.value(cells); ok && val != "" {
+		sub.ProblemName = &val
+	}
+	if val, ok := p.size.value(cells); ok {
+		size, err := strconv.ParseFloat(strings.ReplaceAll(val, ",", "."), 64)
+		if err != nil {
+			zap.S().Warnw("Invalid size string", "size", val, "submission_id", sub.ID)
+		} else {
+			sub.SizeKB = &size
+		}
+	}
+
+	date, _ := p.date.value(cells)
+	date = p.monthReplacer.Replace(p.dateReplacer.Replace(date))
+	sub.Date, err = time.ParseInLocation(p.conf.DateFormat, date, p.location)
+	if err != nil {
+		return nil, ParseError(fmt.Errorf("invalid time of submission %d: %w", sub.ID, err))
+	}
+
+	status, _ := p.status.value(cells)
+	var noScore bool
+	for _, rule := range p.conf.StatusRules {
+		if !strings.Contains(status, rule.Contains) {
+			continue
+		}
+		sub.Handled = sub.Handled && !rule.Pending
+		sub.Ignored = sub.Ignored || rule.Ignored
+		sub.CompileError = sub.CompileError || rule.CompileError
+		sub.InternalError = sub.InternalError || rule.InternalError
+		noScore = noScore || rule.NoScore
+	}
+	if val, ok := p.score.value(cells); ok && !noScore {
+		score, err := strconv.Atoi(val)
+		if err != nil {
+			zap.S().Infow("Invalid score", "score", val, "submission_id", sub.ID)
+		} else {
+			sub.Score = &score
+		}
+	}
+	return sub, nil
+}
+
+func (p *DeclarativeParser) GetPage(ctx context.Context, offset int) ([]*Submission, error) {
+	pageURL := strings.NewReplacer(
+		"{offset}", strconv.Itoa(offset),
+		"{page}", strconv.Itoa(offset/p.conf.PageSize+1),
+	).Replace(p.conf.URL)
+	resp, err := Get(ctx, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return nil, ParseError(err)
+	}
+	rows := doc.Find(p.conf.RowSelector)
+	subs := make([]*Submission, 0, rows.Length())
+	for i := range rows.Nodes {
+		sub, err := p.parseSubmission(rows.Eq(i))
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (p *DeclarativeParser) PageZeroOffset() int {
+	return 0
+}
+
+func (p *DeclarativeParser) FurthestOffset(ctx context.Context, db *DB) (int, error) {
+	return db.CountSubmissions(ctx)
+}
+
+func (p *DeclarativeParser) NextPageOffset(t int, subs []*Submission) int {
+	return t + len(subs)
+}
+
+func (p *DeclarativeParser) PageOffset(start int, n int) int {
+	return start + n*p.conf.PageSize
+}
+
+func (p *DeclarativeParser) ProblemURL(problemID string) string {
+	if p.conf.ProblemURL == "" {
+		return ""
+	}
+	return strings.ReplaceAll(p.conf.ProblemURL, "{id}", url.PathEscape(problemID))
+}
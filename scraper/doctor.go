@@ -0,0 +1,186 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Maximum number of affected IDs or usernames listed for each check
+const doctorSamples = 10
+
+// Dates may go back this much as IDs increase before being reported, since local times are ambiguous when DST ends
+const monotonicSlack = 2 * time.Hour
+
+// DoctorCheck is the outcome of an integrity check of a submission dump
+type DoctorCheck struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Number of affected rows (or users, for display names) and a few of their IDs (or usernames)
+	Count   int      `json:"count"`
+	Samples []string `json:"samples,omitempty"`
+
+	Repairable bool `json:"repairable"`
+	Repaired   int  `json:"repaired"`
+}
+
+// DoctorReport holds the integrity checks of a platform's dump
+type DoctorReport struct {
+	Platform    string        `json:"platform"`
+	Submissions int           `json:"submissions"`
+	Checks      []DoctorCheck `json:"checks"`
+}
+
+type doctorCheck struct {
+	name        string
+	description string
+	// Selects the ID (or username) of every affected row
+	query string
+	// Fixes the affected rows, returning how many were changed. nil if they cannot be repaired automatically
+	repair func(ctx context.Context, tx *sqlx.Tx) (int, error)
+}
+
+// execRepair returns a repair running a single statement
+func execRepair(stmt string) func(ctx context.Context, tx *sqlx.Tx) (int, error) {
+	return func(ctx context.Context, tx *sqlx.Tx) (int, error) {
+		res, err := tx.ExecContext(ctx, stmt)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		return int(n), err
+	}
+}
+
+// parseStoredDate parses a date stored in a format SQLite does not understand, such as the output of time.Time.String
+func parseStoredDate(s string) (time.Time, bool) {
+	s, _, _ = strings.Cut(strings.TrimSpace(s), " m=")
+	layouts := append([]string{"2006-01-02 15:04:05.999999999 -0700 MST", time.RFC1123Z, time.RFC1123}, sqlite3.SQLiteTimestampFormats...)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// repairDates rewrites the dates that can be parsed in the format used when inserting submissions, and deletes the other rows
+func repairDates(ctx context.Context, tx *sqlx.Tx) (int, error) {
+	var rows []struct {
+		ID   int    `db:"id"`
+		Date string `db:"date"`
+	}
+	if err := tx.SelectContext(ctx, &rows, "SELECT id, date FROM submissions WHERE unixepoch(date) IS NULL"); err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		var err error
+		if t, ok := parseStoredDate(row.Date); ok {
+			_, err = tx.ExecContext(ctx, "UPDATE submissions SET date = ? WHERE id = ?", t.Format(sqlite3.SQLiteTimestampFormats[0]), row.ID)
+		} else {
+			_, err = tx.ExecContext(ctx, "DELETE FROM submissions WHERE id = ?", row.ID)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(rows), nil
+}
+
+// Dates are repaired first, since the other checks rely on them
+var doctorChecks = []doctorCheck{
+	{
+		name:        "unparseable_date",
+		description: "Dates that cannot be parsed. Repair rewrites them in the standard format, or deletes the row if that fails",
+		query:       "SELECT CAST(id AS TEXT) FROM submissions WHERE unixepoch(date) IS NULL ORDER BY id",
+		repair:      repairDates,
+	},
+	{
+		name:        "future_date",
+		description: "Dates more than a day in the future. Repair deletes the rows",
+		query:       "SELECT CAST(id AS TEXT) FROM submissions WHERE unixepoch(date) > unixepoch('now', '+1 day') ORDER BY id",
+		repair:      execRepair("DELETE FROM submissions WHERE unixepoch(date) > unixepoch('now', '+1 day')"),
+	},
+	{
+		name:        "invalid_id",
+		description: "IDs that are not positive. Repair deletes the rows",
+		query:       "SELECT CAST(id AS TEXT) FROM submissions WHERE id <= 0 ORDER BY id",
+		repair:      execRepair("DELETE FROM submissions WHERE id <= 0"),
+	},
+	{
+		name:        "graded_without_problem",
+		description: "Graded submissions without a problem ID",
+		query:       "SELECT CAST(id AS TEXT) FROM submissions WHERE problem_id IS NULL AND score IS NOT NULL ORDER BY id",
+	},
+	{
+		name:        "impossible_score",
+		description: "Scores outside of 0-100. Repair clears them",
+		query:       "SELECT CAST(id AS TEXT) FROM submissions WHERE score < 0 OR score > 100 ORDER BY id",
+		repair:      execRepair("UPDATE submissions SET score = NULL WHERE score < 0 OR score > 100"),
+	},
+	{
+		name:        "non_monotonic_date",
+		description: "Submissions dated before a submission with a lower ID",
+		query: `SELECT CAST(id AS TEXT) FROM (
+			SELECT id, unixepoch(date) AS ts, MAX(unixepoch(date)) OVER (ORDER BY id ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING) AS prev
+			FROM submissions
+		) WHERE ts < prev - ` + strconv.Itoa(int(monotonicSlack.Seconds())) + ` ORDER BY id`,
+	},
+	{
+		name:        "duplicate_display_names",
+		description: "Users with several display names. Repair keeps the one of their newest submission",
+		query:       "SELECT username FROM submissions GROUP BY username HAVING COUNT(DISTINCT display_name) > 1 ORDER BY username",
+		// The newest display names are found once, in a single pass over the submissions, since there is no index on username
+		repair: execRepair(`WITH newest AS (
+			SELECT username, display_name FROM submissions WHERE id IN (
+				SELECT MAX(id) FROM submissions GROUP BY username HAVING COUNT(DISTINCT display_name) > 1
+			)
+		)
+		UPDATE submissions SET display_name = newest.display_name FROM newest
+		WHERE submissions.username = newest.username AND submissions.display_name != newest.display_name`),
+	},
+}
+
+// Doctor runs the integrity checks of the dump, repairing the affected rows if repair is set
+func (s *DB) Doctor(ctx context.Context, repair bool) (*DoctorReport, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &DoctorReport{Platform: s.PlatformName}
+	if err := tx.GetContext(ctx, &report.Submissions, "SELECT COUNT(*) FROM submissions"); err != nil {
+		return nil, err
+	}
+	for _, check := range doctorChecks {
+		var keys []string
+		if err := tx.SelectContext(ctx, &keys, check.query); err != nil {
+			return nil, fmt.Errorf("check %s: %w", check.name, err)
+		}
+		result := DoctorCheck{
+			Name:        check.name,
+			Description: check.description,
+			Count:       len(keys),
+			Samples:     keys[:min(len(keys), doctorSamples)],
+			Repairable:  check.repair != nil,
+		}
+		if repair && check.repair != nil && len(keys) > 0 {
+			result.Repaired, err = check.repair(ctx, tx)
+			if err != nil {
+				return nil, fmt.Errorf("repair %s: %w", check.name, err)
+			}
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
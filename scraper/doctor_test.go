@@ -0,0 +1,126 @@
+package scraper
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// corruptSubmission is a row of the dump, stored as-is so that it can break the integrity checks
+type corruptSubmission struct {
+	id          int
+	username    string
+	displayName string
+	problemID   any
+	score       any
+	date        string
+}
+
+// newCorruptDB creates a dump with the rows affected by every doctor check
+func newCorruptDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB("test", filepath.Join(t.TempDir(), "dump.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.db.Close() })
+
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	date := func(t time.Time) string { return t.Format(sqlite3.SQLiteTimestampFormats[0]) }
+	rows := []corruptSubmission{
+		{-1, "ana", "Ana", "1", 100, date(base)},
+		{1, "ana", "Ana", "1", 100, date(base.Add(time.Hour))},
+		{2, "bob", "Bob", nil, 50, date(base.Add(2 * time.Hour))},
+		{3, "bob", "Bob", "1", 150, date(base.Add(3 * time.Hour))},
+		{4, "bob", "Bob", "1", 100, base.Add(4*time.Hour).String() + " m=+0.5"},
+		{5, "bob", "Bob", "1", 100, "garbage"},
+		{6, "ana", "Ana P", "2", 0, date(base.Add(6 * time.Hour))},
+		{7, "bob", "Bob", "2", 0, date(base.Add(time.Hour))},
+		{8, "bob", "Bob", "2", 0, date(time.Now().AddDate(0, 0, 3))},
+	}
+	for _, row := range rows {
+		if _, err := db.db.Exec("INSERT INTO submissions (id, username, display_name, problem_id, score, date) VALUES (?, ?, ?, ?, ?, ?)",
+			row.id, row.username, row.displayName, row.problemID, row.score, row.date); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestDoctor(t *testing.T) {
+	db := newCorruptDB(t)
+	ctx := context.Background()
+
+	want := map[string][]string{
+		"unparseable_date":        {"4", "5"},
+		"future_date":             {"8"},
+		"invalid_id":              {"-1"},
+		"graded_without_problem":  {"2"},
+		"impossible_score":        {"3"},
+		"non_monotonic_date":      {"7"},
+		"duplicate_display_names": {"ana"},
+	}
+	report, err := db.Doctor(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Checks) != len(want) {
+		t.Fatalf("got %d checks, want %d", len(report.Checks), len(want))
+	}
+	for _, check := range report.Checks {
+		if !slices.Equal(check.Samples, want[check.Name]) || check.Count != len(want[check.Name]) {
+			t.Errorf("%s: got %d rows %v, want %v", check.Name, check.Count, check.Samples, want[check.Name])
+		}
+		if check.Repaired != 0 {
+			t.Errorf("%s: repaired %d rows without repair", check.Name, check.Repaired)
+		}
+	}
+
+	report, err = db.Doctor(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range report.Checks {
+		if check.Repairable && check.Repaired == 0 {
+			t.Errorf("%s: nothing repaired", check.Name)
+		}
+	}
+
+	// Only the checks which cannot be repaired are left
+	report, err = db.Doctor(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range report.Checks {
+		if check.Repairable && check.Count > 0 {
+			t.Errorf("%s: %v left after repair", check.Name, check.Samples)
+		} else if !check.Repairable && !slices.Equal(check.Samples, want[check.Name]) {
+			t.Errorf("%s: got %v after repair, want %v", check.Name, check.Samples, want[check.Name])
+		}
+	}
+
+	var got []corruptSubmission
+	r, err := db.db.Query("SELECT id, display_name, date FROM submissions WHERE id IN (1, 4, 5) ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for r.Next() {
+		var row corruptSubmission
+		if err := r.Scan(&row.id, &row.displayName, &row.date); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	wantRows := []corruptSubmission{
+		{id: 1, displayName: "Ana P", date: "2024-03-01 11:00:00+00:00"},
+		{id: 4, displayName: "Bob", date: "2024-03-01 14:00:00+00:00"},
+	}
+	if !slices.Equal(got, wantRows) {
+		t.Errorf("got repaired rows %+v, want %+v", got, wantRows)
+	}
+}
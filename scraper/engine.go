@@ -0,0 +1,140 @@
+package scraper
+
+import (
+	"context"
+	"time"
+)
+
+// SubmissionColumns are the SQL expressions of the submission fields the statistics are computed from
+type SubmissionColumns struct {
+	// Submissions table, or a query producing it
+	Table string
+
+	User    string
+	Problem string
+	// Submission time, of the type Dialect.Time converts to
+	Date          string
+	Score         string
+	CompileError  string
+	InternalError string
+}
+
+// Dialect writes the parts of the statistics queries that differ between databases
+type Dialect interface {
+	Columns() SubmissionColumns
+
+	// Placeholder returns the bind parameter of the n-th query argument, counting from 1
+	Placeholder(n int) string
+	// Time converts a time into an argument comparable with the Date column
+	Time(t time.Time) any
+	// PeriodStart returns the unix timestamp of the start of the period containing date, an expression of the Date column's type.
+	// Rolling intervals are anchored at anchor
+	PeriodStart(args *QueryArgs, g Granularity, date string, anchor time.Time, loc *time.Location) string
+	// Median aggregates the median of expr
+	Median(expr string) string
+	// Pair identifies the (user, problem) pair of a submission, for counting distinct pairs
+	Pair() string
+	// Exclusions returns a condition (to be AND-ed to a WHERE clause) that leaves out the excluded submissions
+	Exclusions(args *QueryArgs, e *Exclusions) string
+}
+
+// QueryArgs collects the arguments of a query while its text is written, so placeholders are numbered in order
+type QueryArgs struct {
+	dialect Dialect
+	Args    []any
+}
+
+// Add appends an argument, returning its placeholder
+func (a *QueryArgs) Add(v any) string {
+	a.Args = append(a.Args, v)
+	return a.dialect.Placeholder(len(a.Args))
+}
+
+// Selector runs a query, scanning the rows into dest (a pointer to a slice of structs) by their db tags
+type Selector interface {
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+}
+
+// StatsEngine computes the statistics of a platform with the same queries on every database,
+// so that SQLite dumps and the Kilonova database return identical rows for identical submissions
+type StatsEngine struct {
+	Platform string
+	Dialect  Dialect
+	DB       Selector
+}
+
+// Stats computes the statistics for every period of the query's granularity, newest first, with the user activity if the query asks for it
+func (e *StatsEngine) Stats(ctx context.Context, q StatsQuery) ([]*StatsRow, error) {
+	from, to := q.Range(time.Now())
+	c := e.Dialect.Columns()
+	args := &QueryArgs{dialect: e.Dialect}
+
+	query := `WITH starting_data AS (
+		SELECT ` + c.User + ` AS user_id, ` + c.Problem + ` AS problem_id, ` + c.Score + ` AS score,
+			` + c.CompileError + ` AS compile_error, ` + c.InternalError + ` AS internal_error,
+			` + e.Dialect.PeriodStart(args, q.Granularity, c.Date, to, q.Loc()) + ` AS period
+		FROM ` + c.Table + `
+		WHERE ` + c.Date + ` >= ` + args.Add(e.Dialect.Time(from)) + ` AND ` + c.Date + ` < ` + args.Add(e.Dialect.Time(to)) + `
+			AND ` + e.Dialect.Exclusions(args, q.Exclude) + `
+	) SELECT
+		COUNT(*) AS num_submissions,
+		COUNT(DISTINCT ` + e.Dialect.Pair() + `) AS excluding_multiple,
+		COUNT(DISTINCT user_id) AS unique_users,
+		COUNT(DISTINCT problem_id) AS unique_problems,
+		COUNT(*) FILTER (WHERE score = 100) AS full_score,
+		COUNT(*) FILTER (WHERE compile_error) AS compile_errors,
+		COUNT(*) FILTER (WHERE internal_error) AS internal_errors,
+		CAST(AVG(score) AS DOUBLE PRECISION) AS mean_score,
+		` + e.Dialect.Median("score") + ` AS median_score,
+		COUNT(DISTINCT ` + e.Dialect.Pair() + `) FILTER (WHERE score = 100) AS solved_pairs,
+		period
+	FROM starting_data GROUP BY period ORDER BY period DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ` + args.Add(q.Limit)
+	}
+
+	var rows []*StatsRow
+	if err := e.DB.SelectContext(ctx, &rows, query, args.Args...); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		row.PlatformName = e.Platform
+		row.Time = time.Unix(row.Period, 0).In(q.Loc())
+		row.ComputeRates()
+	}
+
+	if !q.UserActivity {
+		return rows, nil
+	}
+	from = ActivityFrom(q, rows, from)
+	activity, err := e.UserActivity(ctx, q, from, to)
+	if err != nil {
+		return nil, err
+	}
+	ApplyUserActivity(rows, q.Granularity, activity, from)
+	return rows, nil
+}
+
+// UserActivity returns the users active in each period of [from, to)
+func (e *StatsEngine) UserActivity(ctx context.Context, q StatsQuery, from, to time.Time) ([]UserPeriod, error) {
+	c := e.Dialect.Columns()
+	args := &QueryArgs{dialect: e.Dialect}
+
+	query := `WITH first_seen AS (
+		SELECT ` + c.User + ` AS user_id, MIN(` + c.Date + `) AS first FROM ` + c.Table + `
+		WHERE ` + e.Dialect.Exclusions(args, q.Exclude) + ` GROUP BY ` + c.User + `
+	), active AS (
+		SELECT DISTINCT ` + c.User + ` AS user_id, ` + e.Dialect.PeriodStart(args, q.Granularity, c.Date, to, q.Loc()) + ` AS period
+		FROM ` + c.Table + `
+		WHERE ` + c.Date + ` >= ` + args.Add(e.Dialect.Time(from)) + ` AND ` + c.Date + ` < ` + args.Add(e.Dialect.Time(to)) + `
+			AND ` + e.Dialect.Exclusions(args, q.Exclude) + `
+	) SELECT
+		CAST(active.user_id AS TEXT) AS username,
+		active.period,
+		` + e.Dialect.PeriodStart(args, q.Granularity, "first_seen.first", to, q.Loc()) + ` = active.period AS is_new
+	FROM active INNER JOIN first_seen ON active.user_id = first_seen.user_id`
+
+	var activity []UserPeriod
+	err := e.DB.SelectContext(ctx, &activity, query, args.Args...)
+	return activity, err
+}
@@ -0,0 +1,100 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Scraping errors wrap one of these, so callers can tell whether retrying makes sense
+var (
+	// ErrParse means a page or a stored row could not be parsed. Retrying will not help
+	ErrParse = errors.New("parse error")
+	// ErrTransient means the request failed in a way that may succeed if retried, such as a network or server error
+	ErrTransient = errors.New("transient error")
+	// ErrBlocked means the platform refused to serve the request, such as with a 403 or 429 status
+	ErrBlocked = errors.New("blocked")
+)
+
+// Error classes counted by the metrics, besides the ones of the above errors
+const (
+	ErrorClassFetch  = "fetch"
+	ErrorClassInsert = "insert"
+	ErrorClassOffset = "offset"
+)
+
+// Bytes of the response body kept in a StatusError
+const statusErrorBody = 4 << 10
+
+// StatusError is a client error status (4xx) returned by a platform, other than the ones of ErrBlocked. It is not retried
+type StatusError struct {
+	URL    string
+	Status string
+	Code   int
+	// Start of the response body, which may explain the error
+	Body []byte
+}
+
+func (e *StatusError) Error() string {
+	return e.URL + " returned " + e.Status
+}
+
+// ErrorClass returns the metrics class of a fetch error
+func ErrorClass(err error) string {
+	switch {
+	case errors.Is(err, ErrParse):
+		return "parse"
+	case errors.Is(err, ErrTransient):
+		return "transient"
+	case errors.Is(err, ErrBlocked):
+		return "blocked"
+	}
+	return ErrorClassFetch
+}
+
+// Retryable reports whether fetching a page again may succeed after err.
+// Unclassified errors are retried, the same as transient ones, but client error statuses are not
+func Retryable(err error) bool {
+	var statusErr *StatusError
+	return !errors.Is(err, ErrParse) && !errors.Is(err, ErrBlocked) && !errors.As(err, &statusErr) &&
+		!errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// ParseError marks err as an ErrParse
+func ParseError(err error) error {
+	return fmt.Errorf("%w: %w", ErrParse, err)
+}
+
+// Get fetches a page, returning failed requests and error statuses as ErrTransient, ErrBlocked or a *StatusError.
+// Canceled requests return ctx.Err() as is. The caller must close the response body
+func Get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, vals := range header {
+		req.Header[key] = vals
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %w", ErrTransient, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusUnavailableForLegalReasons:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s returned %s", ErrBlocked, url, resp.Status)
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode >= 500:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s returned %s", ErrTransient, url, resp.Status)
+	case resp.StatusCode >= 400:
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, statusErrorBody))
+		return nil, &StatusError{URL: url, Status: resp.Status, Code: resp.StatusCode, Body: body}
+	}
+	return resp, nil
+}
@@ -0,0 +1,168 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Exclusions describe the submissions left out of every statistics query, such as those of bots, admins or test accounts.
+type Exclusions struct {
+	// User IDs or usernames
+	Users []string `json:"users"`
+	// Regular expressions matched against the username
+	UserPatterns []string `json:"user_patterns"`
+	// Problem IDs
+	Problems []string `json:"problems"`
+
+	CompileErrors  bool `json:"compile_errors"`
+	Ignored        bool `json:"ignored"`
+	InternalErrors bool `json:"internal_errors"`
+}
+
+type ExclusionKind string
+
+const (
+	ExcludeUsers          ExclusionKind = "users"
+	ExcludeUserPattern    ExclusionKind = "user_pattern"
+	ExcludeProblems       ExclusionKind = "problems"
+	ExcludeCompileErrors  ExclusionKind = "compile_errors"
+	ExcludeIgnored        ExclusionKind = "ignored"
+	ExcludeInternalErrors ExclusionKind = "internal_errors"
+)
+
+// ExclusionRule is a single condition of an Exclusions set. A submission is excluded if it matches any rule.
+type ExclusionRule struct {
+	Kind   ExclusionKind
+	Values []string
+}
+
+func (r ExclusionRule) String() string {
+	if len(r.Values) == 0 {
+		return string(r.Kind)
+	}
+	return string(r.Kind) + ": " + strings.Join(r.Values, ", ")
+}
+
+// Rules lists the rules of the exclusion set. Every user pattern is a separate rule
+func (e *Exclusions) Rules() []ExclusionRule {
+	if e == nil {
+		return nil
+	}
+	var rules []ExclusionRule
+	if len(e.Users) > 0 {
+		rules = append(rules, ExclusionRule{Kind: ExcludeUsers, Values: e.Users})
+	}
+	for _, pattern := range e.UserPatterns {
+		rules = append(rules, ExclusionRule{Kind: ExcludeUserPattern, Values: []string{pattern}})
+	}
+	if len(e.Problems) > 0 {
+		rules = append(rules, ExclusionRule{Kind: ExcludeProblems, Values: e.Problems})
+	}
+	if e.CompileErrors {
+		rules = append(rules, ExclusionRule{Kind: ExcludeCompileErrors})
+	}
+	if e.Ignored {
+		rules = append(rules, ExclusionRule{Kind: ExcludeIgnored})
+	}
+	if e.InternalErrors {
+		rules = append(rules, ExclusionRule{Kind: ExcludeInternalErrors})
+	}
+	return rules
+}
+
+// Validate checks that the user patterns are valid regular expressions
+func (e *Exclusions) Validate() error {
+	if e == nil {
+		return nil
+	}
+	for _, pattern := range e.UserPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid user pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ExcludedCount is the number of submissions matched by an exclusion rule.
+// Submissions matching multiple rules are counted for each of them.
+type ExcludedCount struct {
+	Rule  string `json:"rule"`
+	Count int    `json:"count"`
+}
+
+// placeholders returns n comma-separated SQLite placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(vals []string) []any {
+	args := make([]any, len(vals))
+	for i := range vals {
+		args[i] = vals[i]
+	}
+	return args
+}
+
+// sqliteRuleCond returns the SQLite condition matching the submissions of a rule
+func sqliteRuleCond(r ExclusionRule) (string, []any) {
+	switch r.Kind {
+	case ExcludeUsers:
+		return "(username IN (" + placeholders(len(r.Values)) + ") OR (user_id IS NOT NULL AND user_id IN (" + placeholders(len(r.Values)) + ")))", append(stringArgs(r.Values), stringArgs(r.Values)...)
+	case ExcludeUserPattern:
+		return "username REGEXP ?", stringArgs(r.Values)
+	case ExcludeProblems:
+		return "(problem_id IS NOT NULL AND problem_id IN (" + placeholders(len(r.Values)) + "))", stringArgs(r.Values)
+	case ExcludeCompileErrors:
+		return "compile_error", nil
+	case ExcludeIgnored:
+		return "ignored", nil
+	case ExcludeInternalErrors:
+		return "internal_error", nil
+	}
+	return "FALSE", nil
+}
+
+// sqliteExclusionsCond returns a condition (to be AND-ed to a WHERE clause) that leaves out the excluded submissions
+func sqliteExclusionsCond(e *Exclusions) (string, []any) {
+	var sb strings.Builder
+	var args []any
+	sb.WriteString("TRUE")
+	for _, rule := range e.Rules() {
+		cond, condArgs := sqliteRuleCond(rule)
+		sb.WriteString(" AND NOT " + cond)
+		args = append(args, condArgs...)
+	}
+	return sb.String(), args
+}
+
+// ExcludedCounts counts the submissions matched by each exclusion rule
+func (s *DB) ExcludedCounts(ctx context.Context, e *Exclusions) ([]ExcludedCount, error) {
+	var counts []ExcludedCount
+	for _, rule := range e.Rules() {
+		cond, args := sqliteRuleCond(rule)
+		var cnt int
+		if err := s.db.GetContext(ctx, &cnt, "SELECT COUNT(*) FROM submissions WHERE "+cond, args...); err != nil {
+			return nil, err
+		}
+		counts = append(counts, ExcludedCount{Rule: rule.String(), Count: cnt})
+	}
+	return counts, nil
+}
+
+var regexps sync.Map
+
+// sqliteRegexp implements the REGEXP operator for SQLite
+func sqliteRegexp(pattern, s string) (bool, error) {
+	if re, ok := regexps.Load(pattern); ok {
+		return re.(*regexp.Regexp).MatchString(s), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	regexps.Store(pattern, re)
+	return re.MatchString(s), nil
+}
@@ -0,0 +1,231 @@
+package scraper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Unit string
+
+const (
+	UnitHour    Unit = "hour"
+	UnitDay     Unit = "day"
+	UnitWeek    Unit = "week" // ISO week, starting on monday
+	UnitMonth   Unit = "month"
+	UnitQuarter Unit = "quarter"
+	UnitYear    Unit = "year"
+	UnitRolling Unit = "rolling" // N-day intervals, anchored at the end of the queried range
+)
+
+// Granularity is the size of the periods statistics are bucketed into.
+type Granularity struct {
+	Unit Unit
+	// Number of days in an interval. Only for UnitRolling
+	Days int
+}
+
+var (
+	Hourly    = Granularity{Unit: UnitHour}
+	Daily     = Granularity{Unit: UnitDay}
+	Weekly    = Granularity{Unit: UnitWeek}
+	Monthly   = Granularity{Unit: UnitMonth}
+	Quarterly = Granularity{Unit: UnitQuarter}
+	Yearly    = Granularity{Unit: UnitYear}
+)
+
+func Rolling(days int) Granularity {
+	return Granularity{Unit: UnitRolling, Days: days}
+}
+
+// ParseGranularity parses a unit name (hour, day, week, month, quarter, year) or a rolling interval written as "30d".
+func ParseGranularity(s string) (Granularity, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch Unit(s) {
+	case UnitHour, UnitDay, UnitWeek, UnitMonth, UnitQuarter, UnitYear:
+		return Granularity{Unit: Unit(s)}, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n > 0 {
+			return Rolling(n), nil
+		}
+	}
+	return Granularity{}, fmt.Errorf("invalid granularity %q", s)
+}
+
+func (g Granularity) String() string {
+	if g.Unit == UnitRolling {
+		return strconv.Itoa(g.Days) + "d"
+	}
+	return string(g.Unit)
+}
+
+// Truncate returns the start of the period containing t. For rolling intervals, the anchor is the (exclusive) end of the newest interval.
+func (g Granularity) Truncate(t time.Time, anchor time.Time) time.Time {
+	switch g.Unit {
+	case UnitHour:
+		// Truncate the wall clock time with the offset in effect at t, so the repeated hour at the end of DST stays two periods
+		_, offset := t.Zone()
+		off := time.Duration(offset) * time.Second
+		return t.Add(off).Truncate(time.Hour).Add(-off)
+	case UnitDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case UnitWeek:
+		offset := (int(t.Weekday()) + 6) % 7 // days since monday
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+	case UnitMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case UnitQuarter:
+		return time.Date(t.Year(), t.Month()-(t.Month()-1)%3, 1, 0, 0, 0, 0, t.Location())
+	case UnitYear:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	case UnitRolling:
+		// Count calendar days instead of dividing durations, so DST changes do not shift the boundaries
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		anchorDay := time.Date(anchor.Year(), anchor.Month(), anchor.Day(), 0, 0, 0, 0, time.UTC)
+		diff := int(anchorDay.Sub(day).Hours()) / 24
+		k := (diff + g.Days - 1) / g.Days
+		if diff <= 0 {
+			k = -((-diff) / g.Days)
+		}
+		return time.Date(anchor.Year(), anchor.Month(), anchor.Day()-k*g.Days, 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+// Next returns the start of the period following the one starting at t
+func (g Granularity) Next(t time.Time) time.Time {
+	return g.add(t, 1)
+}
+
+// Prev returns the start of the period preceding the one starting at t
+func (g Granularity) Prev(t time.Time) time.Time {
+	return g.add(t, -1)
+}
+
+func (g Granularity) add(t time.Time, n int) time.Time {
+	switch g.Unit {
+	case UnitHour:
+		return t.Add(time.Duration(n) * time.Hour)
+	case UnitDay:
+		return t.AddDate(0, 0, n)
+	case UnitWeek:
+		return t.AddDate(0, 0, 7*n)
+	case UnitMonth:
+		return t.AddDate(0, n, 0)
+	case UnitQuarter:
+		return t.AddDate(0, 3*n, 0)
+	case UnitYear:
+		return t.AddDate(n, 0, 0)
+	case UnitRolling:
+		return t.AddDate(0, 0, g.Days*n)
+	}
+	return t
+}
+
+// Label formats the start of a period for display
+func (g Granularity) Label(t time.Time) string {
+	switch g.Unit {
+	case UnitHour:
+		return t.Format("2006-01-02 15:00 MST")
+	case UnitWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d (%s)", year, week, t.Format(time.DateOnly))
+	case UnitMonth:
+		return t.Format("January 2006")
+	case UnitQuarter:
+		return fmt.Sprintf("%d Q%d", t.Year(), (int(t.Month())-1)/3+1)
+	case UnitYear:
+		return t.Format("2006")
+	case UnitRolling:
+		return t.Format(time.DateOnly) + " - " + t.AddDate(0, 0, g.Days).Format(time.DateOnly)
+	}
+	return t.Format(time.DateOnly)
+}
+
+// StatsQuery describes a statistics query over a range of submissions.
+type StatsQuery struct {
+	Granularity Granularity
+
+	// Submissions in [From, To) are counted. A zero From means since the first submission, a zero To means until the end of today.
+	From time.Time
+	To   time.Time
+
+	// Reporting timezone that periods are bucketed in. nil means UTC
+	Location *time.Location
+
+	// Submissions left out of the statistics. nil means none
+	Exclude *Exclusions
+
+	// Maximum number of periods returned, newest first. 0 means no limit
+	Limit int
+
+	// Whether to also compute the new, returning and churned users of each period (and the active users of days).
+	// This takes another query over the submissions, so only the tables that show them set it
+	UserActivity bool
+}
+
+// Loc returns the reporting timezone of the query
+func (q StatsQuery) Loc() *time.Location {
+	if q.Location == nil {
+		return time.UTC
+	}
+	return q.Location
+}
+
+// Range returns the effective [from, to) range of the query, resolving the zero values relative to now.
+// Rolling intervals are anchored at the returned end.
+func (q StatsQuery) Range(now time.Time) (from time.Time, to time.Time) {
+	from, to = q.From, q.To
+	if to.IsZero() {
+		now = now.In(q.Loc())
+		to = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, q.Loc())
+	}
+	return from, to
+}
+
+// StatsOptions selects the standard set of statistics for a platform
+type StatsOptions struct {
+	NumDays          int
+	NumMonths        int
+	RollInterval     int
+	NumRollingMonths int
+	// Number of monthly cohorts in the retention matrix. 0 disables it
+	NumCohorts int
+	// Number of days the activity heatmap covers. 0 disables it
+	HeatmapDays int
+
+	// Reporting timezone. nil means UTC
+	Location *time.Location
+
+	// Submissions left out of all statistics. nil means none
+	Exclude *Exclusions
+
+	// Queries for additional granularities. Their exclusions are replaced with the above
+	Extra []StatsQuery
+
+	Leaderboards LeaderboardOptions
+}
+
+// Queries returns the day, month and rolling interval queries of the options
+func (o StatsOptions) Queries() (days, months, rolling StatsQuery) {
+	days = StatsQuery{Granularity: Daily, Limit: o.NumDays, Location: o.Location, Exclude: o.Exclude, UserActivity: true}
+	months = StatsQuery{Granularity: Monthly, Limit: o.NumMonths, Location: o.Location, Exclude: o.Exclude, UserActivity: true}
+	rolling = StatsQuery{Granularity: Rolling(o.RollInterval), Limit: o.NumRollingMonths, Location: o.Location, Exclude: o.Exclude, UserActivity: true}
+	return
+}
+
+func (g Granularity) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+func (g *Granularity) UnmarshalText(data []byte) error {
+	gg, err := ParseGranularity(string(data))
+	if err != nil {
+		return err
+	}
+	*g = gg
+	return nil
+}
@@ -0,0 +1,45 @@
+package scraper
+
+import (
+	"time"
+)
+
+// Heatmap counts the submissions of a window by day of week and hour of day, in the reporting timezone
+type Heatmap struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	// Counts[d][h] is the number of submissions on weekday d (0 is monday) at hour h
+	Counts [7][24]int `json:"counts"`
+}
+
+// Max returns the largest count of the heatmap
+func (h *Heatmap) Max() int {
+	var mx int
+	for _, day := range h.Counts {
+		for _, cnt := range day {
+			mx = max(mx, cnt)
+		}
+	}
+	return mx
+}
+
+// HeatmapQuery returns the hourly query over the last days, up to the end of today
+func HeatmapQuery(days int, loc *time.Location, exclude *Exclusions) StatsQuery {
+	q := StatsQuery{Granularity: Hourly, Location: loc, Exclude: exclude}
+	_, to := q.Range(time.Now())
+	q.From = to.AddDate(0, 0, -days)
+	q.To = to
+	return q
+}
+
+// HeatmapFromHourly adds up hourly stats into a heatmap
+func HeatmapFromHourly(q StatsQuery, rows []*StatsRow) *Heatmap {
+	h := &Heatmap{From: q.From, To: q.To}
+	for _, row := range rows {
+		t := row.Time.In(q.Loc())
+		day := (int(t.Weekday()) + 6) % 7
+		h.Counts[day][t.Hour()] += row.NumSubmissions
+	}
+	return h
+}
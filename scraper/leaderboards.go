@@ -0,0 +1,183 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+// ProblemLinker is implemented by parsers that can link to the problems of their platform
+type ProblemLinker interface {
+	ProblemURL(problemID string) string
+}
+
+// LeaderboardOptions selects the leaderboards computed for each platform
+type LeaderboardOptions struct {
+	Granularity Granularity
+	// Number of periods, the newest being the current one
+	Periods int
+	// Number of entries in each leaderboard. 0 disables the leaderboards
+	TopN int
+}
+
+// Problems with fewer users are left out of the lowest success rate leaderboard, since their rate is mostly noise
+const minHardestUsers = 5
+
+// LeaderboardEntry is a problem or a user in a leaderboard
+type LeaderboardEntry struct {
+	ID   string `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	URL  string `json:"url,omitempty" db:"-"`
+
+	Submissions int `json:"submissions" db:"submissions"`
+	// Distinct users who submitted to the problem, or distinct problems the user submitted to
+	Attempted int `json:"attempted" db:"attempted"`
+	// Of those, the ones with a 100 point submission
+	Solved int `json:"solved" db:"solved"`
+}
+
+// SuccessRate is the share of Attempted that was solved, from 0 to 1
+func (e LeaderboardEntry) SuccessRate() float64 {
+	if e.Attempted == 0 {
+		return 0
+	}
+	return float64(e.Solved) / float64(e.Attempted)
+}
+
+// Leaderboard holds the top problems and users of a period
+type Leaderboard struct {
+	Granularity Granularity `json:"granularity"`
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+
+	MostSubmitted []LeaderboardEntry `json:"most_submitted"`
+	MostSolved    []LeaderboardEntry `json:"most_solved"`
+	// Problems with the lowest success rate, out of those attempted by at least a few users
+	Hardest    []LeaderboardEntry `json:"hardest"`
+	MostActive []LeaderboardEntry `json:"most_active_users"`
+}
+
+// Label formats the period of the leaderboard for display
+func (l *Leaderboard) Label() string {
+	return l.Granularity.Label(l.From)
+}
+
+// LeaderboardPeriods returns the [from, to) ranges of the leaderboard periods, newest first
+func (o LeaderboardOptions) LeaderboardPeriods(loc *time.Location) [][2]time.Time {
+	q := StatsQuery{Granularity: o.Granularity, Location: loc}
+	_, end := q.Range(time.Now())
+	start := o.Granularity.Truncate(time.Now().In(q.Loc()), end)
+	var periods [][2]time.Time
+	for i := 0; i < o.Periods; i++ {
+		next := o.Granularity.Next(start)
+		periods = append(periods, [2]time.Time{start, next})
+		start = o.Granularity.Prev(start)
+	}
+	return periods
+}
+
+func topN(entries []LeaderboardEntry, n int, compare func(a, b LeaderboardEntry) int) []LeaderboardEntry {
+	entries = slices.Clone(entries)
+	slices.SortStableFunc(entries, compare)
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// byCount compares two counts, breaking ties by ID so the order is stable across runs
+func byCount(x, y int, a, b LeaderboardEntry) int {
+	if c := cmp.Compare(x, y); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.ID, b.ID)
+}
+
+// BuildLeaderboard ranks the per-problem and per-user counts of a period
+func BuildLeaderboard(g Granularity, from, to time.Time, problems, users []LeaderboardEntry, n int) *Leaderboard {
+	var attempted []LeaderboardEntry
+	for _, pb := range problems {
+		if pb.Attempted >= minHardestUsers {
+			attempted = append(attempted, pb)
+		}
+	}
+	return &Leaderboard{
+		Granularity: g,
+		From:        from,
+		To:          to,
+
+		MostSubmitted: topN(problems, n, func(a, b LeaderboardEntry) int {
+			return byCount(b.Submissions, a.Submissions, a, b)
+		}),
+		MostSolved: topN(problems, n, func(a, b LeaderboardEntry) int {
+			return byCount(b.Solved, a.Solved, a, b)
+		}),
+		Hardest: topN(attempted, n, func(a, b LeaderboardEntry) int {
+			if c := cmp.Compare(a.SuccessRate(), b.SuccessRate()); c != 0 {
+				return c
+			}
+			return byCount(b.Attempted, a.Attempted, a, b)
+		}),
+		MostActive: topN(users, n, func(a, b LeaderboardEntry) int {
+			return byCount(b.Submissions, a.Submissions, a, b)
+		}),
+	}
+}
+
+// ProblemActivity counts the submissions, users and solving users of each problem in [from, to)
+func (s *DB) ProblemActivity(ctx context.Context, from, to time.Time, exclude *Exclusions) ([]LeaderboardEntry, error) {
+	exclCond, exclArgs := sqliteExclusionsCond(exclude)
+	args := append([]any{from.Unix(), to.Unix()}, exclArgs...)
+
+	var problems []LeaderboardEntry
+	if err := s.db.SelectContext(ctx, &problems, `
+	SELECT
+		problem_id AS id,
+		COALESCE(MAX(problem_name), '') AS name,
+		COUNT(*) AS submissions,
+		COUNT(DISTINCT username) AS attempted,
+		COUNT(DISTINCT CASE WHEN score = 100 THEN username END) AS solved
+	FROM submissions
+	WHERE unixepoch(date) >= ? AND unixepoch(date) < ? AND problem_id IS NOT NULL AND `+exclCond+`
+	GROUP BY problem_id`, args...); err != nil {
+		return nil, err
+	}
+	if s.ProblemURL != nil {
+		for i := range problems {
+			problems[i].URL = s.ProblemURL(problems[i].ID)
+		}
+	}
+	return problems, nil
+}
+
+// Leaderboards computes the leaderboards of the platform, newest period first
+func (s *DB) Leaderboards(ctx context.Context, opts LeaderboardOptions, loc *time.Location, exclude *Exclusions) ([]*Leaderboard, error) {
+	exclCond, exclArgs := sqliteExclusionsCond(exclude)
+
+	var boards []*Leaderboard
+	for _, period := range opts.LeaderboardPeriods(loc) {
+		problems, err := s.ProblemActivity(ctx, period[0], period[1], exclude)
+		if err != nil {
+			return nil, err
+		}
+
+		args := append([]any{period[0].Unix(), period[1].Unix()}, exclArgs...)
+		var users []LeaderboardEntry
+		if err := s.db.SelectContext(ctx, &users, `
+		SELECT
+			username AS id,
+			MAX(display_name) AS name,
+			COUNT(*) AS submissions,
+			COUNT(DISTINCT problem_id) AS attempted,
+			COUNT(DISTINCT CASE WHEN score = 100 THEN problem_id END) AS solved
+		FROM submissions
+		WHERE unixepoch(date) >= ? AND unixepoch(date) < ? AND `+exclCond+`
+		GROUP BY username`, args...); err != nil {
+			return nil, err
+		}
+
+		boards = append(boards, BuildLeaderboard(opts.Granularity, period[0], period[1], problems, users, opts.TopN))
+	}
+	return boards, nil
+}
@@ -0,0 +1,197 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upper bounds (in seconds) of the fetch latency histogram buckets
+var fetchBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type platformMetrics struct {
+	pagesFetched int
+	rowsInserted int
+	rowsUpdated  int
+	rowsSkipped  int
+	errors       map[string]int
+
+	// Cumulative counts for each of fetchBuckets
+	fetchBuckets []int
+	fetchCount   int
+	fetchSum     float64
+
+	backlogOffset    *float64
+	newestSubmission time.Time
+}
+
+// Metrics tracks the health of the scrapers, exposed in the Prometheus text format
+type Metrics struct {
+	mu        sync.Mutex
+	platforms map[string]*platformMetrics
+}
+
+// DefaultMetrics is updated by every scraper
+var DefaultMetrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{platforms: make(map[string]*platformMetrics)}
+}
+
+// platform returns the metrics of a platform, creating them if needed. m.mu must be held
+func (m *Metrics) platform(name string) *platformMetrics {
+	pm, ok := m.platforms[name]
+	if !ok {
+		pm = &platformMetrics{errors: make(map[string]int), fetchBuckets: make([]int, len(fetchBuckets))}
+		m.platforms[name] = pm
+	}
+	return pm
+}
+
+// ObserveFetch records a fetched page and how long fetching it took
+func (m *Metrics) ObserveFetch(platform string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pm := m.platform(platform)
+	pm.pagesFetched++
+	pm.fetchCount++
+	pm.fetchSum += d.Seconds()
+	for i, le := range fetchBuckets {
+		if d.Seconds() <= le {
+			pm.fetchBuckets[i]++
+		}
+	}
+}
+
+// ObserveRows records the outcome of inserting a page of submissions
+func (m *Metrics) ObserveRows(platform string, inserted, updated, skipped int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pm := m.platform(platform)
+	pm.rowsInserted += inserted
+	pm.rowsUpdated += updated
+	pm.rowsSkipped += skipped
+}
+
+// ObserveError counts an error of the given class
+func (m *Metrics) ObserveError(platform string, class string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.platform(platform).errors[class]++
+}
+
+// SetBacklogOffset records the current offset of the backlog scrape. Offsets that are not numbers or times are ignored
+func (m *Metrics) SetBacklogOffset(platform string, offset any) {
+	var val float64
+	switch offset := offset.(type) {
+	case int:
+		val = float64(offset)
+	case *time.Time:
+		if offset == nil {
+			return
+		}
+		val = float64(offset.Unix())
+	default:
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.platform(platform).backlogOffset = &val
+}
+
+// ObserveSubmission records the time of a scraped submission, keeping the newest one
+func (m *Metrics) ObserveSubmission(platform string, date time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pm := m.platform(platform)
+	if date.After(pm.newestSubmission) {
+		pm.newestSubmission = date
+	}
+}
+
+// labelEscaper escapes label values, the exposition format only having escapes for backslashes, double quotes and line feeds
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabel(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for name := range m.platforms {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var sb strings.Builder
+	metric := func(name, typ, help string, values func(pl string, pm *platformMetrics)) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, pl := range names {
+			values(pl, m.platforms[pl])
+		}
+	}
+	sample := func(name, labels string, v float64) {
+		fmt.Fprintf(&sb, "%s{%s} %s\n", name, labels, formatValue(v))
+	}
+	platformLabel := func(pl string) string {
+		return formatLabel("platform", pl)
+	}
+
+	metric("ia_kn_stats_pages_fetched_total", "counter", "Monitor pages fetched.", func(pl string, pm *platformMetrics) {
+		sample("ia_kn_stats_pages_fetched_total", platformLabel(pl), float64(pm.pagesFetched))
+	})
+	metric("ia_kn_stats_rows_total", "counter", "Scraped submissions by outcome: inserted, updated (already known) or skipped (not evaluated yet or failed to insert).", func(pl string, pm *platformMetrics) {
+		sample("ia_kn_stats_rows_total", platformLabel(pl)+`,outcome="inserted"`, float64(pm.rowsInserted))
+		sample("ia_kn_stats_rows_total", platformLabel(pl)+`,outcome="updated"`, float64(pm.rowsUpdated))
+		sample("ia_kn_stats_rows_total", platformLabel(pl)+`,outcome="skipped"`, float64(pm.rowsSkipped))
+	})
+	metric("ia_kn_stats_errors_total", "counter", "Scraping errors by class.", func(pl string, pm *platformMetrics) {
+		var classes []string
+		for class := range pm.errors {
+			classes = append(classes, class)
+		}
+		slices.Sort(classes)
+		for _, class := range classes {
+			sample("ia_kn_stats_errors_total", platformLabel(pl)+","+formatLabel("class", class), float64(pm.errors[class]))
+		}
+	})
+	metric("ia_kn_stats_fetch_duration_seconds", "histogram", "Time taken to fetch a monitor page.", func(pl string, pm *platformMetrics) {
+		for i, le := range fetchBuckets {
+			sample("ia_kn_stats_fetch_duration_seconds_bucket", platformLabel(pl)+`,le="`+formatValue(le)+`"`, float64(pm.fetchBuckets[i]))
+		}
+		sample("ia_kn_stats_fetch_duration_seconds_bucket", platformLabel(pl)+`,le="+Inf"`, float64(pm.fetchCount))
+		sample("ia_kn_stats_fetch_duration_seconds_sum", platformLabel(pl), pm.fetchSum)
+		sample("ia_kn_stats_fetch_duration_seconds_count", platformLabel(pl), float64(pm.fetchCount))
+	})
+	metric("ia_kn_stats_backlog_offset", "gauge", "Current offset of the backlog scrape (a count or a unix timestamp, depending on the platform).", func(pl string, pm *platformMetrics) {
+		if pm.backlogOffset != nil {
+			sample("ia_kn_stats_backlog_offset", platformLabel(pl), *pm.backlogOffset)
+		}
+	})
+	metric("ia_kn_stats_newest_submission_timestamp_seconds", "gauge", "Unix time of the newest scraped submission.", func(pl string, pm *platformMetrics) {
+		if !pm.newestSubmission.IsZero() {
+			sample("ia_kn_stats_newest_submission_timestamp_seconds", platformLabel(pl), float64(pm.newestSubmission.Unix()))
+		}
+	})
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
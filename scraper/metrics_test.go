@@ -0,0 +1,100 @@
+package scraper
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveFetch("Infoarena", 250*time.Millisecond) // on the edge of the 0.25 bucket
+	m.ObserveFetch("Infoarena", 2*time.Second)
+	m.ObserveFetch("Infoarena", 40*time.Second) // only in +Inf
+	m.ObserveRows("Infoarena", 20, 5, 3)
+	m.ObserveRows("Infoarena", 1, 0, 0)
+	m.ObserveError("Infoarena", "transient")
+	m.ObserveError("Infoarena", "parse")
+	m.ObserveError("Infoarena", "transient")
+	m.ObserveSubmission("Infoarena", time.Unix(1700000000, 0))
+	m.ObserveSubmission("Infoarena", time.Unix(1600000000, 0))
+	m.SetBacklogOffset("Infoarena", 1200)
+
+	// Platforms of monitors come from the config file, so their names may need escaping
+	weird := "Var\"ena\\ă\n"
+	offset := time.Unix(1500000000, 0)
+	m.SetBacklogOffset(weird, &offset)
+	m.SetBacklogOffset(weird, struct{ User int }{2}) // ignored, not a number or a time
+	m.ObserveError(weird, "blocked")
+
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got content type %q", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP ia_kn_stats_pages_fetched_total Monitor pages fetched.
+# TYPE ia_kn_stats_pages_fetched_total counter
+ia_kn_stats_pages_fetched_total{platform="Infoarena"} 3
+ia_kn_stats_pages_fetched_total{platform="Var\"ena\\ă\n"} 0
+# HELP ia_kn_stats_rows_total Scraped submissions by outcome: inserted, updated (already known) or skipped (not evaluated yet or failed to insert).
+# TYPE ia_kn_stats_rows_total counter
+ia_kn_stats_rows_total{platform="Infoarena",outcome="inserted"} 21
+ia_kn_stats_rows_total{platform="Infoarena",outcome="updated"} 5
+ia_kn_stats_rows_total{platform="Infoarena",outcome="skipped"} 3
+ia_kn_stats_rows_total{platform="Var\"ena\\ă\n",outcome="inserted"} 0
+ia_kn_stats_rows_total{platform="Var\"ena\\ă\n",outcome="updated"} 0
+ia_kn_stats_rows_total{platform="Var\"ena\\ă\n",outcome="skipped"} 0
+# HELP ia_kn_stats_errors_total Scraping errors by class.
+# TYPE ia_kn_stats_errors_total counter
+ia_kn_stats_errors_total{platform="Infoarena",class="parse"} 1
+ia_kn_stats_errors_total{platform="Infoarena",class="transient"} 2
+ia_kn_stats_errors_total{platform="Var\"ena\\ă\n",class="blocked"} 1
+# HELP ia_kn_stats_fetch_duration_seconds Time taken to fetch a monitor page.
+# TYPE ia_kn_stats_fetch_duration_seconds histogram
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Infoarena",le="0.1"} 0
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Infoarena",le="0.25"} 1
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Infoarena",le="0.5"} 1
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Infoarena",le="1"} 1
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Infoarena",le="2.5"} 2
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Infoarena",le="5"} 2
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Infoarena",le="10"} 2
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Infoarena",le="30"} 2
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Infoarena",le="+Inf"} 3
+ia_kn_stats_fetch_duration_seconds_sum{platform="Infoarena"} 42.25
+ia_kn_stats_fetch_duration_seconds_count{platform="Infoarena"} 3
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Var\"ena\\ă\n",le="0.1"} 0
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Var\"ena\\ă\n",le="0.25"} 0
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Var\"ena\\ă\n",le="0.5"} 0
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Var\"ena\\ă\n",le="1"} 0
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Var\"ena\\ă\n",le="2.5"} 0
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Var\"ena\\ă\n",le="5"} 0
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Var\"ena\\ă\n",le="10"} 0
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Var\"ena\\ă\n",le="30"} 0
+ia_kn_stats_fetch_duration_seconds_bucket{platform="Var\"ena\\ă\n",le="+Inf"} 0
+ia_kn_stats_fetch_duration_seconds_sum{platform="Var\"ena\\ă\n"} 0
+ia_kn_stats_fetch_duration_seconds_count{platform="Var\"ena\\ă\n"} 0
+# HELP ia_kn_stats_backlog_offset Current offset of the backlog scrape (a count or a unix timestamp, depending on the platform).
+# TYPE ia_kn_stats_backlog_offset gauge
+ia_kn_stats_backlog_offset{platform="Infoarena"} 1200
+ia_kn_stats_backlog_offset{platform="Var\"ena\\ă\n"} 1.5e+09
+# HELP ia_kn_stats_newest_submission_timestamp_seconds Unix time of the newest scraped submission.
+# TYPE ia_kn_stats_newest_submission_timestamp_seconds gauge
+ia_kn_stats_newest_submission_timestamp_seconds{platform="Infoarena"} 1.7e+09
+`
+	if string(body) != want {
+		t.Errorf("got metrics\n%s\nwant\n%s", body, want)
+	}
+}
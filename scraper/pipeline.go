@@ -0,0 +1,220 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// PagedParser is implemented by parsers with fixed size pages, whose offsets are known before fetching them,
+// so that the backlog can be fetched concurrently
+type PagedParser[Offset any] interface {
+	Parser[Offset]
+	// PageOffset returns the offset of the page n pages after start
+	PageOffset(start Offset, n int) Offset
+}
+
+// PipelineOptions configures the concurrent backlog scrape
+type PipelineOptions struct {
+	// Number of concurrent page fetchers. At most 1 fetches one page at a time, like parsers without fixed size pages
+	Workers int
+	// Maximum number of requests per second over all fetchers. 0 means no limit
+	Rate float64
+	// Maximum number of pages fetched but not yet written
+	QueueSize int
+	// Number of pages committed in a single transaction
+	BatchSize int
+}
+
+// Time waited before fetching a page again after an error
+const retryDelay = time.Second
+
+// rateLimiter spaces out requests to at most rate per second
+type rateLimiter struct {
+	ticker *time.Ticker
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	if rate <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{ticker: time.NewTicker(time.Duration(float64(time.Second) / rate))}
+}
+
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l.ticker == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-l.ticker.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *rateLimiter) Stop() {
+	if l.ticker != nil {
+		l.ticker.Stop()
+	}
+}
+
+// fetchPageRetrying fetches a page until it succeeds. It fails if ctx is done or the error cannot be retried
+func (sc *Scraper[Token]) fetchPageRetrying(ctx context.Context, limiter *rateLimiter, offset Token) ([]*Submission, error) {
+	for {
+		if err := limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		subs, err := sc.fetchPage(ctx, offset)
+		if err == nil {
+			return subs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !Retryable(err) {
+			return nil, err
+		}
+		zap.S().Warnw("Could not fetch page", "platform", sc.DB.PlatformName, "offset", offset, "error", err)
+		if err := waitRetry(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type fetchedPage struct {
+	n    int
+	subs []*Submission
+}
+
+// parseBacklogConcurrent scrapes the backlog with concurrent fetchers feeding a single writer, which commits the pages in order.
+// The offset is computed once, progress is then tracked by the range of committed pages
+func (sc *Scraper[Token]) parseBacklogConcurrent(ctx context.Context, parser PagedParser[Token]) error {
+	opts := sc.Pipeline
+	start, err := parser.FurthestOffset(ctx, sc.DB)
+	if err != nil {
+		DefaultMetrics.ObserveError(sc.DB.PlatformName, ErrorClassOffset)
+		return fmt.Errorf("could not compute offset: %w", err)
+	}
+	zap.S().Infow("Starting concurrent long scrape", "platform", sc.DB.PlatformName, "offset", start, "workers", opts.Workers)
+	DefaultMetrics.SetBacklogOffset(sc.DB.PlatformName, start)
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queueSize := max(opts.QueueSize, opts.Workers)
+	batchSize := max(opts.BatchSize, 1)
+
+	// A slot is taken for every dispatched page and released once the writer has it,
+	// so fetchers are never more than queueSize pages ahead of the writer
+	window := make(chan struct{}, queueSize)
+	jobs := make(chan int)
+	pages := make(chan fetchedPage, queueSize)
+
+	go func() {
+		defer close(jobs)
+		for n := 0; ; n++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	limiter := newRateLimiter(opts.Rate)
+	defer limiter.Stop()
+	// The first error that cannot be retried stops every fetcher
+	var fetchErr error
+	var fetchErrOnce sync.Once
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range jobs {
+				subs, err := sc.fetchPageRetrying(ctx, limiter, parser.PageOffset(start, n))
+				if err != nil {
+					if ctx.Err() == nil {
+						fetchErrOnce.Do(func() {
+							fetchErr = err
+							cancel()
+						})
+					}
+					return
+				}
+				select {
+				case pages <- fetchedPage{n: n, subs: subs}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(pages)
+	}()
+
+	began := time.Now()
+	pending := make(map[int][]*Submission)
+	var batch []*Submission
+	var committed, next int
+	flush := func() error {
+		if next == committed {
+			return nil
+		}
+		// Pages already fetched are still committed when the scrape is canceled
+		numInserted, err := sc.DB.InsertMonitorPage(context.WithoutCancel(ctx), batch)
+		if err != nil {
+			return err
+		}
+		zap.S().Infow("Committed pages", "platform", sc.DB.PlatformName,
+			"from_offset", parser.PageOffset(start, committed), "to_offset", parser.PageOffset(start, next),
+			"inserted", numInserted, "pages_per_second", float64(next)/time.Since(began).Seconds())
+		DefaultMetrics.SetBacklogOffset(sc.DB.PlatformName, parser.PageOffset(start, next))
+		batch, committed = nil, next
+		return nil
+	}
+
+	for page := range pages {
+		pending[page.n] = page.subs
+		for {
+			subs, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if len(subs) == 0 {
+				zap.S().Infow("Found page with no more submissions, might have reached the end", "platform", sc.DB.PlatformName, "offset", parser.PageOffset(start, next))
+				return flush()
+			}
+			batch = append(batch, subs...)
+			next++
+			<-window
+			if next-committed >= batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// The fetchers only stop early when the scrape is canceled or fails
+	if err := flush(); err != nil {
+		return err
+	}
+	if fetchErr != nil {
+		return fetchErr
+	}
+	zap.S().Infow("Quitting", "platform", sc.DB.PlatformName)
+	return parent.Err()
+}
@@ -0,0 +1,166 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	testPages    = 64
+	testPageSize = 50
+	// Base latency of a monitor page, pages also take up to 4 more milliseconds so that fetches finish out of order
+	testLatency = time.Millisecond
+)
+
+// newMonitorServer serves testPages fixed size pages of submissions, newest first, as JSON.
+// ?first=k returns the submissions from the k-th newest one, past the last page the page is empty
+func newMonitorServer(tb testing.TB) *httptest.Server {
+	total := testPages * testPageSize
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first, err := strconv.Atoi(r.URL.Query().Get("first"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		time.Sleep(testLatency + time.Duration(first/testPageSize*7%5)*time.Millisecond)
+		subs := []*Submission{}
+		for i := first; i < min(first+testPageSize, total); i++ {
+			id := total - i
+			problem := strconv.Itoa(id % 100)
+			subs = append(subs, &Submission{
+				ID:          id,
+				Username:    "user" + strconv.Itoa(id%37),
+				DisplayName: "User " + strconv.Itoa(id%37),
+				ProblemID:   &problem,
+				ProblemName: &problem,
+				Date:        time.Unix(1700000000+int64(id)*60, 0).UTC(),
+				Handled:     true,
+			})
+		}
+		json.NewEncoder(w).Encode(subs)
+	}))
+	tb.Cleanup(srv.Close)
+	return srv
+}
+
+// monitorParser scrapes newMonitorServer, its offsets being the number of newer submissions
+type monitorParser struct {
+	url string
+}
+
+var _ PagedParser[int] = &monitorParser{}
+
+func (p *monitorParser) GetPage(ctx context.Context, offset int) ([]*Submission, error) {
+	resp, err := Get(ctx, p.url+"?first="+strconv.Itoa(offset), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var subs []*Submission
+	if err := json.NewDecoder(resp.Body).Decode(&subs); err != nil {
+		return nil, ParseError(err)
+	}
+	return subs, nil
+}
+
+func (p *monitorParser) PageZeroOffset() int {
+	return 0
+}
+
+func (p *monitorParser) FurthestOffset(ctx context.Context, db *DB) (int, error) {
+	return db.CountSubmissions(ctx)
+}
+
+func (p *monitorParser) NextPageOffset(t int, subs []*Submission) int {
+	return t + len(subs)
+}
+
+func (p *monitorParser) PageOffset(start int, n int) int {
+	return start + n*testPageSize
+}
+
+// newTestScraper returns a scraper of srv on an empty database, which logs the order the submissions are inserted in
+func newTestScraper(tb testing.TB, srv *httptest.Server, opts PipelineOptions) *Scraper[int] {
+	tb.Helper()
+	sc, err := New[int]("Test", filepath.Join(tb.TempDir(), "dump.db"), &monitorParser{url: srv.URL})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { sc.DB.db.Close() })
+	sc.Pipeline = opts
+	if _, err := sc.DB.db.Exec(`
+CREATE TABLE insert_log (seq INTEGER PRIMARY KEY AUTOINCREMENT, id INTEGER NOT NULL);
+CREATE TRIGGER log_insert AFTER INSERT ON submissions BEGIN
+	INSERT INTO insert_log (id) VALUES (NEW.id);
+END;`); err != nil {
+		tb.Fatal(err)
+	}
+	return sc
+}
+
+// checkCommitOrder checks that every submission was inserted once, in the order of the pages
+func checkCommitOrder(tb testing.TB, db *DB) {
+	tb.Helper()
+	var ids []int
+	if err := db.db.Select(&ids, "SELECT id FROM insert_log ORDER BY seq"); err != nil {
+		tb.Fatal(err)
+	}
+	if len(ids) != testPages*testPageSize {
+		tb.Fatalf("inserted %d submissions, want %d", len(ids), testPages*testPageSize)
+	}
+	for i, id := range ids {
+		if want := testPages*testPageSize - i; id != want {
+			tb.Fatalf("submission %d inserted at position %d, want %d", id, i, want)
+		}
+	}
+}
+
+var pipelineOptions = []PipelineOptions{
+	{Workers: 1, BatchSize: 4},
+	{Workers: 2, QueueSize: 2, BatchSize: 4},
+	{Workers: 4, QueueSize: 4, BatchSize: 4},
+	{Workers: 4, QueueSize: 16, BatchSize: 4},
+	{Workers: 8, QueueSize: 8, BatchSize: 4},
+	{Workers: 8, QueueSize: 32, BatchSize: 4},
+	{Workers: 16, QueueSize: 64, BatchSize: 4},
+}
+
+func TestParseBacklogOrder(t *testing.T) {
+	srv := newMonitorServer(t)
+	for _, opts := range pipelineOptions {
+		t.Run(fmt.Sprintf("workers=%d/queue=%d", opts.Workers, opts.QueueSize), func(t *testing.T) {
+			sc := newTestScraper(t, srv, opts)
+			if err := sc.ParseBacklog(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			checkCommitOrder(t, sc.DB)
+		})
+	}
+}
+
+func BenchmarkParseBacklog(b *testing.B) {
+	srv := newMonitorServer(b)
+	for _, opts := range pipelineOptions {
+		b.Run(fmt.Sprintf("workers=%d/queue=%d", opts.Workers, opts.QueueSize), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				sc := newTestScraper(b, srv, opts)
+				b.StartTimer()
+				if err := sc.ParseBacklog(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				checkCommitOrder(b, sc.DB)
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(b.N*testPages)/b.Elapsed().Seconds(), "pages/s")
+		})
+	}
+}
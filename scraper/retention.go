@@ -0,0 +1,223 @@
+package scraper
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// UserPeriod marks a user as active in a period
+type UserPeriod struct {
+	Username string `db:"username"`
+	// Unix timestamp of the period start
+	Period int64 `db:"period"`
+	// Whether the user's first submission on the platform is in this period
+	IsNew bool `db:"is_new"`
+}
+
+// ActivityFrom returns the start of the range the user activity should be queried for,
+// so that the period before the oldest row is also included. For day stats, the whole trailing 30 days of the oldest row are included
+func ActivityFrom(q StatsQuery, rows []*StatsRow, from time.Time) time.Time {
+	if len(rows) == 0 {
+		return from
+	}
+	oldest := rows[0].Time
+	for _, row := range rows {
+		if row.Time.Before(oldest) {
+			oldest = row.Time
+		}
+	}
+	prev := q.Granularity.Prev(oldest)
+	if q.Granularity == Daily {
+		prev = oldest.AddDate(0, 0, 1-monthlyActiveDays)
+	}
+	if prev.After(from) {
+		return prev
+	}
+	return from
+}
+
+// ApplyUserActivity fills in the new, returning and churned user counts of the rows from the per-period user activity.
+// from is the start of the range the activity was queried for: churn is only computed if the previous period starts after it.
+func ApplyUserActivity(rows []*StatsRow, g Granularity, activity []UserPeriod, from time.Time) {
+	users := make(map[int64]map[string]bool)
+	newUsers := make(map[int64]int)
+	for _, act := range activity {
+		if users[act.Period] == nil {
+			users[act.Period] = make(map[string]bool)
+		}
+		users[act.Period][act.Username] = true
+		if act.IsNew {
+			newUsers[act.Period]++
+		}
+	}
+
+	for _, row := range rows {
+		period := row.Time.Unix()
+		row.NewUsers = newUsers[period]
+		row.ReturningUsers = len(users[period]) - row.NewUsers
+
+		prev := g.Prev(row.Time)
+		if prev.Before(from) {
+			continue
+		}
+		var churned int
+		for user := range users[prev.Unix()] {
+			if !users[period][user] {
+				churned++
+			}
+		}
+		row.ChurnedUsers = &churned
+	}
+
+	if g == Daily {
+		applyActiveUsers(rows, users, from)
+	}
+}
+
+const (
+	weeklyActiveDays  = 7
+	monthlyActiveDays = 30
+)
+
+// activeWindow counts the distinct users of a sliding window of days
+type activeWindow map[string]int
+
+func (w activeWindow) add(users map[string]bool) {
+	for user := range users {
+		w[user]++
+	}
+}
+
+func (w activeWindow) remove(users map[string]bool) {
+	for user := range users {
+		if w[user]--; w[user] == 0 {
+			delete(w, user)
+		}
+	}
+}
+
+// applyActiveUsers fills in the sliding window active user counts of day rows, given the users active in each day since from.
+// The windows slide over the days from the oldest row, adding the day entering them and removing the day leaving them
+func applyActiveUsers(rows []*StatsRow, users map[int64]map[string]bool, from time.Time) {
+	if len(rows) == 0 {
+		return
+	}
+	byDay := make(map[int64]*StatsRow)
+	oldest, newest := rows[0].Time, rows[0].Time
+	for _, row := range rows {
+		byDay[row.Time.Unix()] = row
+		if row.Time.Before(oldest) {
+			oldest = row.Time
+		}
+		if row.Time.After(newest) {
+			newest = row.Time
+		}
+	}
+
+	start := oldest.AddDate(0, 0, 1-monthlyActiveDays)
+	weekly, monthly := make(activeWindow), make(activeWindow)
+	for day := start; !day.After(newest); day = day.AddDate(0, 0, 1) {
+		weekly.add(users[day.Unix()])
+		monthly.add(users[day.Unix()])
+		// Only the days since start were added
+		if left := day.AddDate(0, 0, -weeklyActiveDays); !left.Before(start) {
+			weekly.remove(users[left.Unix()])
+		}
+		if left := day.AddDate(0, 0, -monthlyActiveDays); !left.Before(start) {
+			monthly.remove(users[left.Unix()])
+		}
+
+		row := byDay[day.Unix()]
+		if row == nil || day.AddDate(0, 0, 1-weeklyActiveDays).Before(from) {
+			continue
+		}
+		wau := len(weekly)
+		row.WeeklyActiveUsers = &wau
+
+		if day.AddDate(0, 0, 1-monthlyActiveDays).Before(from) {
+			continue
+		}
+		mau := len(monthly)
+		row.MonthlyActiveUsers = &mau
+		if mau > 0 {
+			stickiness := float64(row.UniqueUsers) / float64(mau)
+			row.Stickiness = &stickiness
+		}
+	}
+}
+
+// Cohort is the group of users whose first submission on the platform was in the same calendar month
+type Cohort struct {
+	Month time.Time `json:"month"`
+	Users int       `json:"users"`
+	// Retention[i] is the share (from 0 to 1) of the cohort's users who submitted i months after their first month.
+	// Only months up to the current one are included
+	Retention []float64 `json:"retention"`
+}
+
+// CohortsQuery returns the monthly query covering the last n calendar months, up to the end of today
+func CohortsQuery(n int, loc *time.Location, exclude *Exclusions) StatsQuery {
+	q := StatsQuery{Granularity: Monthly, Location: loc, Exclude: exclude}
+	now := time.Now().In(q.Loc())
+	q.From = time.Date(now.Year(), now.Month()-time.Month(n-1), 1, 0, 0, 0, 0, q.Loc())
+	return q
+}
+
+func monthsBetween(a, b time.Time) int {
+	return (b.Year()-a.Year())*12 + int(b.Month()) - int(a.Month())
+}
+
+// ComputeCohorts builds the retention matrix of the users first seen in the queried range from their monthly activity.
+// The activity must only contain monthly periods. Cohorts are sorted newest first
+func ComputeCohorts(activity []UserPeriod, loc *time.Location) []Cohort {
+	first := make(map[string]int64)
+	for _, act := range activity {
+		if act.IsNew {
+			first[act.Username] = act.Period
+		}
+	}
+
+	cohortUsers := make(map[int64]int)
+	active := make(map[int64]map[int]int)
+	for _, month := range first {
+		cohortUsers[month]++
+		if active[month] == nil {
+			active[month] = make(map[int]int)
+		}
+	}
+	for _, act := range activity {
+		month, ok := first[act.Username]
+		if !ok {
+			continue
+		}
+		idx := monthsBetween(time.Unix(month, 0).In(loc), time.Unix(act.Period, 0).In(loc))
+		active[month][idx]++
+	}
+
+	now := time.Now().In(loc)
+	cohorts := make([]Cohort, 0, len(cohortUsers))
+	for month, users := range cohortUsers {
+		t := time.Unix(month, 0).In(loc)
+		cohort := Cohort{Month: t, Users: users}
+		for i := 0; i <= monthsBetween(t, now); i++ {
+			cohort.Retention = append(cohort.Retention, float64(active[month][i])/float64(users))
+		}
+		cohorts = append(cohorts, cohort)
+	}
+	slices.SortFunc(cohorts, func(a, b Cohort) int {
+		return b.Month.Compare(a.Month)
+	})
+	return cohorts
+}
+
+// Cohorts computes the retention of the users first seen in each of the last n calendar months
+func (s *DB) Cohorts(ctx context.Context, n int, loc *time.Location, exclude *Exclusions) ([]Cohort, error) {
+	q := CohortsQuery(n, loc, exclude)
+	from, to := q.Range(time.Now())
+	activity, err := s.engine().UserActivity(ctx, q, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return ComputeCohorts(activity, q.Loc()), nil
+}
@@ -3,6 +3,8 @@ package scraper
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -19,21 +21,38 @@ type Parser[Offset any] interface {
 type Scraper[Token any] struct {
 	DB *DB
 
+	// Concurrency of ParseBacklog, for parsers with fixed size pages
+	Pipeline PipelineOptions
+
 	parser Parser[Token]
 }
 
+// fetchPage gets a page of submissions, recording the fetch in the metrics
+func (sc *Scraper[Token]) fetchPage(ctx context.Context, offset Token) ([]*Submission, error) {
+	start := time.Now()
+	subs, err := sc.parser.GetPage(ctx, offset)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			DefaultMetrics.ObserveError(sc.DB.PlatformName, ErrorClass(err))
+		}
+		return nil, err
+	}
+	DefaultMetrics.ObserveFetch(sc.DB.PlatformName, time.Since(start))
+	return subs, nil
+}
+
 func (sc *Scraper[Token]) ParseNewSubs(ctx context.Context) error {
 	offset := sc.parser.PageZeroOffset()
 	for {
-		subs, err := sc.parser.GetPage(ctx, offset)
+		subs, err := sc.fetchPage(ctx, offset)
 		if err != nil {
 			return err
 		}
 		numInserted, err := sc.DB.InsertMonitorPage(ctx, subs)
 		if err != nil {
-			continue
+			return fmt.Errorf("could not insert page: %w", err)
 		}
-		zap.S().Info(offset, numInserted)
+		zap.S().Infow("Scraped page", "platform", sc.DB.PlatformName, "offset", offset, "inserted", numInserted)
 		if numInserted == 0 {
 			break
 		}
@@ -42,41 +61,62 @@ func (sc *Scraper[Token]) ParseNewSubs(ctx context.Context) error {
 	return nil
 }
 
+// waitRetry waits before fetching a page again, returning ctx.Err() if it is done first
+func waitRetry(ctx context.Context) error {
+	select {
+	case <-time.After(retryDelay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ParseBacklog scrapes older submissions until the end of the monitor. Transient errors are retried,
+// while parse errors, the platform blocking the scraper and database errors stop it. A canceled scrape returns context.Canceled
 func (sc *Scraper[Token]) ParseBacklog(ctx context.Context) error {
+	if paged, ok := sc.parser.(PagedParser[Token]); ok && sc.Pipeline.Workers > 1 {
+		return sc.parseBacklogConcurrent(ctx, paged)
+	}
 	offset, err := sc.parser.FurthestOffset(ctx, sc.DB)
 	if err != nil {
-		panic(err)
+		DefaultMetrics.ObserveError(sc.DB.PlatformName, ErrorClassOffset)
+		return fmt.Errorf("could not compute offset: %w", err)
 	}
-	zap.S().Infof("Starting offset for long scrape (%s): %v", sc.DB.PlatformName, offset)
+	zap.S().Infow("Starting long scrape", "platform", sc.DB.PlatformName, "offset", offset)
+	DefaultMetrics.SetBacklogOffset(sc.DB.PlatformName, offset)
 	for {
-		// if offset... {
-		// 	zap.S().Infof("Offset (%s): %d", sc.DB.PlatformName, newOffset)
-		// }
-		subs, err := sc.parser.GetPage(ctx, offset)
+		subs, err := sc.fetchPage(ctx, offset)
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
-				zap.S().Info("Quitting for ", sc.DB.PlatformName)
-				return nil
+				zap.S().Infow("Quitting", "platform", sc.DB.PlatformName)
+				return err
+			}
+			if !Retryable(err) {
+				return err
+			}
+			zap.S().Warnw("Could not fetch page", "platform", sc.DB.PlatformName, "offset", offset, "error", err)
+			if err := waitRetry(ctx); err != nil {
+				return err
 			}
-			zap.S().Warn(err)
 			continue
 		}
 		if len(subs) == 0 {
-			zap.S().Infof("(%s) Found page with no more submissions, might have reached the end", sc.DB.PlatformName)
+			zap.S().Infow("Found page with no more submissions, might have reached the end", "platform", sc.DB.PlatformName, "offset", offset)
 			return nil
 		}
+		// Fetching the page again would not fix the database, so these errors stop the scrape
 		if _, err := sc.DB.InsertMonitorPage(ctx, subs); err != nil {
-			if errors.Is(err, context.Canceled) {
-				zap.S().Info("Quitting for ", sc.DB.PlatformName)
-				return nil
-			}
-			zap.S().Warn(err)
-			continue
+			return fmt.Errorf("could not insert page: %w", err)
 		}
-		offset, err = sc.parser.FurthestOffset(ctx, sc.DB)
+		next, err := sc.parser.FurthestOffset(ctx, sc.DB)
 		if err != nil {
-			zap.S().Warn(err)
+			if !errors.Is(err, context.Canceled) {
+				DefaultMetrics.ObserveError(sc.DB.PlatformName, ErrorClassOffset)
+			}
+			return fmt.Errorf("could not compute offset: %w", err)
 		}
+		offset = next
+		DefaultMetrics.SetBacklogOffset(sc.DB.PlatformName, offset)
 	}
 }
 
@@ -85,5 +125,8 @@ func New[Token any](name, dbname string, parser Parser[Token]) (*Scraper[Token],
 	if err != nil {
 		return nil, err
 	}
-	return &Scraper[Token]{db, parser}, nil
+	if linker, ok := parser.(ProblemLinker); ok {
+		db.ProblemURL = linker.ProblemURL
+	}
+	return &Scraper[Token]{DB: db, parser: parser}, nil
 }
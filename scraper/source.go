@@ -0,0 +1,27 @@
+package scraper
+
+import (
+	"context"
+	"time"
+)
+
+// StatsSource is where the statistics of a platform are computed from,
+// either a local dump of scraped submissions or the platform's own database
+type StatsSource interface {
+	Platform() string
+	Statistics(ctx context.Context, opts StatsOptions) (*Statistics, error)
+
+	UserSummaries(ctx context.Context, exclude *Exclusions) ([]UserSummary, error)
+	// Activity of every problem in [from, to)
+	ProblemActivity(ctx context.Context, from, to time.Time, exclude *Exclusions) ([]LeaderboardEntry, error)
+}
+
+var _ StatsSource = &DB{}
+
+func (s *DB) Platform() string {
+	return s.PlatformName
+}
+
+func (s *DB) Statistics(ctx context.Context, opts StatsOptions) (*Statistics, error) {
+	return s.GetInfoarenaStats(ctx, opts)
+}
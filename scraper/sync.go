@@ -0,0 +1,233 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Reasons for a sync run to stop
+const (
+	StopUpToDate = "up_to_date" // a page had no new submissions
+	StopUntil    = "until"      // the until bound was reached
+	StopMaxPages = "max_pages"
+	StopEnd      = "end" // the platform returned an empty page
+	StopCanceled = "canceled"
+)
+
+// SyncOptions bounds a sync run
+type SyncOptions struct {
+	// Continue the backlog from the furthest scraped offset, instead of scraping the newest submissions until they are known
+	Backlog bool
+	// Stop at the first submission older than UntilTime or with an ID lower than UntilID. Zero values disable them
+	UntilTime time.Time
+	UntilID   int
+	// Maximum number of pages fetched. 0 means no limit
+	MaxPages int
+	// Fetch and parse the pages, but write nothing
+	DryRun bool
+}
+
+// reached reports whether a submission is past the until bounds
+func (o SyncOptions) reached(sub *Submission) bool {
+	return (o.UntilID > 0 && sub.ID < o.UntilID) || (!o.UntilTime.IsZero() && sub.Date.Before(o.UntilTime))
+}
+
+// SubmissionChange is a submission that a sync inserts or updates
+type SubmissionChange struct {
+	ID     int    `json:"id"`
+	Action string `json:"action"`
+	// Fields that differ from the stored submission. Only for updates
+	Fields []string `json:"fields,omitempty"`
+}
+
+const (
+	ActionInsert = "insert"
+	ActionUpdate = "update"
+)
+
+// SyncSummary is the outcome of a sync run on a platform
+type SyncSummary struct {
+	Platform string `json:"platform"`
+	DryRun   bool   `json:"dry_run"`
+
+	Pages   int `json:"pages"`
+	Fetched int `json:"fetched"`
+	// Graded submissions that are new, differ from the stored ones or are already stored as they are
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	// Submissions not graded yet, which are never stored
+	Skipped int `json:"skipped"`
+
+	StartOffset string `json:"start_offset"`
+	EndOffset   string `json:"end_offset"`
+	// Range of the fetched submission IDs
+	NewestID int `json:"newest_id,omitempty"`
+	OldestID int `json:"oldest_id,omitempty"`
+
+	StopReason string `json:"stop_reason"`
+
+	// What a dry run would have written
+	Changes []SubmissionChange `json:"changes,omitempty"`
+}
+
+type storedSubmission struct {
+	Username      string   `db:"username"`
+	DisplayName   string   `db:"display_name"`
+	UserID        *string  `db:"user_id"`
+	ProblemID     *string  `db:"problem_id"`
+	ProblemName   *string  `db:"problem_name"`
+	SizeKB        *float64 `db:"size_kb"`
+	Date          int64    `db:"date"`
+	Ignored       bool     `db:"ignored"`
+	CompileError  bool     `db:"compile_error"`
+	InternalError bool     `db:"internal_error"`
+	Score         *int     `db:"score"`
+}
+
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// DiffSubmissions compares scraped submissions with the stored ones. Submissions not graded yet are left out
+func (s *DB) DiffSubmissions(ctx context.Context, subs []*Submission) ([]SubmissionChange, int, error) {
+	var changes []SubmissionChange
+	var unchanged int
+	for _, sub := range subs {
+		if !sub.Handled {
+			continue
+		}
+		var old storedSubmission
+		err := s.db.GetContext(ctx, &old, `SELECT username, display_name, user_id, problem_id, problem_name, size_kb, unixepoch(date) AS date, ignored, compile_error, internal_error, score
+			FROM submissions WHERE id = ?`, sub.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			changes = append(changes, SubmissionChange{ID: sub.ID, Action: ActionInsert})
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var fields []string
+		for _, f := range []struct {
+			name  string
+			equal bool
+		}{
+			{"username", old.Username == sub.Username},
+			{"display_name", old.DisplayName == sub.DisplayName},
+			{"user_id", equalPtr(old.UserID, sub.UserID)},
+			{"problem_id", equalPtr(old.ProblemID, sub.ProblemID)},
+			{"problem_name", equalPtr(old.ProblemName, sub.ProblemName)},
+			{"size_kb", equalPtr(old.SizeKB, sub.SizeKB)},
+			{"date", old.Date == sub.Date.Unix()},
+			{"ignored", old.Ignored == sub.Ignored},
+			{"compile_error", old.CompileError == sub.CompileError},
+			{"internal_error", old.InternalError == sub.InternalError},
+			{"score", equalPtr(old.Score, sub.Score)},
+		} {
+			if !f.equal {
+				fields = append(fields, f.name)
+			}
+		}
+		if len(fields) == 0 {
+			unchanged++
+			continue
+		}
+		changes = append(changes, SubmissionChange{ID: sub.ID, Action: ActionUpdate, Fields: fields})
+	}
+	return changes, unchanged, nil
+}
+
+// Sync scrapes pages until the platform is up to date or one of the bounds of opts is reached
+func (sc *Scraper[Token]) Sync(ctx context.Context, opts SyncOptions) (*SyncSummary, error) {
+	summary := &SyncSummary{Platform: sc.DB.PlatformName, DryRun: opts.DryRun}
+
+	offset := sc.parser.PageZeroOffset()
+	if opts.Backlog {
+		var err error
+		offset, err = sc.parser.FurthestOffset(ctx, sc.DB)
+		if err != nil {
+			return nil, err
+		}
+	}
+	summary.StartOffset = fmt.Sprint(offset)
+
+	for {
+		summary.EndOffset = fmt.Sprint(offset)
+		if opts.MaxPages > 0 && summary.Pages >= opts.MaxPages {
+			summary.StopReason = StopMaxPages
+			return summary, nil
+		}
+		subs, err := sc.fetchPage(ctx, offset)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				summary.StopReason = StopCanceled
+				return summary, nil
+			}
+			return summary, err
+		}
+		summary.Pages++
+		if len(subs) == 0 {
+			summary.StopReason = StopEnd
+			return summary, nil
+		}
+		next := sc.parser.NextPageOffset(offset, subs)
+
+		var kept []*Submission
+		var reached bool
+		for _, sub := range subs {
+			if opts.reached(sub) {
+				reached = true
+				continue
+			}
+			kept = append(kept, sub)
+			summary.Fetched++
+			if !sub.Handled {
+				summary.Skipped++
+			}
+			if summary.NewestID == 0 || sub.ID > summary.NewestID {
+				summary.NewestID = sub.ID
+			}
+			if summary.OldestID == 0 || sub.ID < summary.OldestID {
+				summary.OldestID = sub.ID
+			}
+		}
+
+		changes, unchanged, err := sc.DB.DiffSubmissions(ctx, kept)
+		if err != nil {
+			return summary, err
+		}
+		var inserted int
+		for _, change := range changes {
+			if change.Action == ActionInsert {
+				inserted++
+			}
+		}
+		summary.Inserted += inserted
+		summary.Updated += len(changes) - inserted
+		summary.Unchanged += unchanged
+		if opts.DryRun {
+			summary.Changes = append(summary.Changes, changes...)
+		} else if _, err := sc.DB.InsertMonitorPage(ctx, kept); err != nil {
+			return summary, err
+		}
+
+		if reached {
+			summary.EndOffset = fmt.Sprint(next)
+			summary.StopReason = StopUntil
+			return summary, nil
+		}
+		if !opts.Backlog && inserted == 0 {
+			summary.EndOffset = fmt.Sprint(next)
+			summary.StopReason = StopUpToDate
+			return summary, nil
+		}
+		offset = next
+	}
+}
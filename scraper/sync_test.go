@@ -0,0 +1,65 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSyncScraper opens the dump at path as a scraper of srv, read-only if readOnly is set
+func newSyncScraper(t *testing.T, path string, srv string, readOnly bool) *Scraper[int] {
+	t.Helper()
+	ReadOnly = readOnly
+	defer func() { ReadOnly = false }()
+	sc, err := New[int]("Test", path, &monitorParser{url: srv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sc.DB.db.Close() })
+	return sc
+}
+
+func TestSyncDryRunWritesNothing(t *testing.T) {
+	srv := newMonitorServer(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "dump.db")
+	if _, err := newSyncScraper(t, path, srv.URL, false).Sync(ctx, SyncOptions{MaxPages: 1}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := newSyncScraper(t, path, srv.URL, true).Sync(ctx, SyncOptions{Backlog: true, MaxPages: 1, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Inserted != testPageSize || len(summary.Changes) != testPageSize {
+		t.Errorf("got %d inserted and %d changes, want %d", summary.Inserted, len(summary.Changes), testPageSize)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("dry run changed the dump")
+	}
+
+	missing := filepath.Join(dir, "missing.db")
+	summary, err = newSyncScraper(t, missing, srv.URL, true).Sync(ctx, SyncOptions{MaxPages: 1, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Inserted != testPageSize {
+		t.Errorf("got %d inserted into a missing dump, want %d", summary.Inserted, testPageSize)
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("dry run created the missing dump: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package scraper
+
+import (
+	"context"
+	"time"
+)
+
+// UserSummary is a user's activity on a platform
+type UserSummary struct {
+	Username    string `json:"username" db:"username"`
+	DisplayName string `json:"display_name" db:"display_name"`
+
+	Submissions     int       `json:"submissions" db:"submissions"`
+	FirstSubmission time.Time `json:"first_submission" db:"first_submission"`
+	LastSubmission  time.Time `json:"last_submission" db:"last_submission"`
+}
+
+// UserSummaries lists the users of the platform, leaving out the excluded submissions
+func (s *DB) UserSummaries(ctx context.Context, exclude *Exclusions) ([]UserSummary, error) {
+	exclCond, exclArgs := sqliteExclusionsCond(exclude)
+	var rows []struct {
+		Username    string `db:"username"`
+		DisplayName string `db:"display_name"`
+		Submissions int    `db:"submissions"`
+		First       int64  `db:"first"`
+		Last        int64  `db:"last"`
+	}
+	if err := s.db.SelectContext(ctx, &rows, `
+	SELECT username, MAX(display_name) AS display_name, COUNT(*) AS submissions, MIN(unixepoch(date)) AS first, MAX(unixepoch(date)) AS last
+	FROM submissions WHERE `+exclCond+` GROUP BY username`, exclArgs...); err != nil {
+		return nil, err
+	}
+
+	users := make([]UserSummary, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, UserSummary{
+			Username:        row.Username,
+			DisplayName:     row.DisplayName,
+			Submissions:     row.Submissions,
+			FirstSubmission: time.Unix(row.First, 0).UTC(),
+			LastSubmission:  time.Unix(row.Last, 0).UTC(),
+		})
+	}
+	return users, nil
+}
@@ -2,95 +2,300 @@ package main
 
 import (
 	"context"
-	"html/template"
+	"fmt"
 	"io"
 	"slices"
 	"strconv"
 	"strings"
 	"time"
 
-	_ "embed"
-
 	"github.com/jackc/pgx/v5"
 	"vasiluta.ro/ia_kn_stats/scraper"
 )
 
-//go:embed templ.body
-var templData string
+const Kilonova = "Kilonova"
 
-var (
-	templ = template.Must(template.New("stats_body").Parse(templData))
+const (
+	KilonovaSourceDB  = "db"
+	KilonovaSourceAPI = "api"
 )
 
-const Kilonova = "Kilonova"
+// kilonovaDialect writes the stats queries for the Kilonova database
+type kilonovaDialect struct{}
+
+func (kilonovaDialect) Columns() scraper.SubmissionColumns {
+	return scraper.SubmissionColumns{
+		Table:         "submissions",
+		User:          "user_id",
+		Problem:       "problem_id",
+		Date:          "created_at",
+		Score:         "score",
+		CompileError:  "compile_error",
+		InternalError: "FALSE", // Kilonova has no internal error submissions
+	}
+}
+
+func (kilonovaDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
 
-func getStats(ctx context.Context, conn *pgx.Conn, query string, args ...any) ([]*scraper.StatsRow, error) {
-	rows, _ := conn.Query(ctx, query, args...)
-	return pgx.CollectRows(rows, pgx.RowToAddrOfStructByNameLax[scraper.StatsRow])
+func (kilonovaDialect) Time(t time.Time) any {
+	return t
+}
+
+// PeriodStart buckets the timestamps on local wall clock time, so that DST changes do not shift the boundaries of rolling intervals
+func (kilonovaDialect) PeriodStart(args *scraper.QueryArgs, g scraper.Granularity, date string, anchor time.Time, loc *time.Location) string {
+	tz := args.Add(loc.String())
+	if g.Unit == scraper.UnitRolling {
+		return fmt.Sprintf(`EXTRACT(EPOCH FROM DATE_BIN('%[2]d days'::interval, %[1]s AT TIME ZONE %[3]s, %[4]s::timestamptz AT TIME ZONE %[3]s) AT TIME ZONE %[3]s)::bigint`, date, g.Days, tz, args.Add(anchor))
+	}
+	return fmt.Sprintf(`EXTRACT(EPOCH FROM DATE_TRUNC('%s', %s, %s))::bigint`, g.Unit, date, tz)
+}
+
+func (kilonovaDialect) Median(expr string) string {
+	return "PERCENTILE_CONT(0.5) WITHIN GROUP (ORDER BY " + expr + ")"
+}
+
+func (kilonovaDialect) Pair() string {
+	return "(user_id, problem_id)"
+}
+
+func (kilonovaDialect) Exclusions(args *scraper.QueryArgs, e *scraper.Exclusions) string {
+	return kilonovaExclusionsCond(e, &args.Args)
+}
+
+// pgxSelector runs the stats engine queries on a Postgres connection
+type pgxSelector struct {
+	conn *pgx.Conn
+}
+
+func (s pgxSelector) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	rows, _ := s.conn.Query(ctx, query, args...)
+	var err error
+	switch dest := dest.(type) {
+	case *[]*scraper.StatsRow:
+		*dest, err = pgx.CollectRows(rows, pgx.RowToAddrOfStructByNameLax[scraper.StatsRow])
+	case *[]scraper.UserPeriod:
+		*dest, err = pgx.CollectRows(rows, pgx.RowToStructByName[scraper.UserPeriod])
+	default:
+		rows.Close()
+		err = fmt.Errorf("cannot select into %T", dest)
+	}
+	return err
+}
+
+func kilonovaEngine(conn *pgx.Conn) *scraper.StatsEngine {
+	return &scraper.StatsEngine{Platform: Kilonova, Dialect: kilonovaDialect{}, DB: pgxSelector{conn}}
+}
+
+// kilonovaRuleCond returns the condition matching the submissions of an exclusion rule, appending its arguments to args
+func kilonovaRuleCond(r scraper.ExclusionRule, args *[]any) string {
+	// Only the rules with values take an argument, Postgres rejects unreferenced ones
+	arg := func() string {
+		*args = append(*args, r.Values)
+		return "$" + strconv.Itoa(len(*args))
+	}
+	switch r.Kind {
+	case scraper.ExcludeUsers:
+		arg := arg()
+		return "(user_id::text = ANY(" + arg + ") OR user_id IN (SELECT id FROM users WHERE name = ANY(" + arg + ")))"
+	case scraper.ExcludeUserPattern:
+		return "user_id IN (SELECT id FROM users WHERE name ~ ANY(" + arg() + "))"
+	case scraper.ExcludeProblems:
+		return "problem_id::text = ANY(" + arg() + ")"
+	case scraper.ExcludeCompileErrors:
+		return "COALESCE(compile_error, FALSE)"
+	}
+	// Kilonova has no ignored or internal error submissions
+	return "FALSE"
+}
+
+// kilonovaExclusionsCond returns a condition (to be AND-ed to a WHERE clause) that leaves out the excluded submissions
+func kilonovaExclusionsCond(e *scraper.Exclusions, args *[]any) string {
+	var sb strings.Builder
+	sb.WriteString("TRUE")
+	for _, rule := range e.Rules() {
+		sb.WriteString(" AND NOT " + kilonovaRuleCond(rule, args))
+	}
+	return sb.String()
 }
 
-func GetKilonovaStats(ctx context.Context, dsn string, numDays, numMonths, rollInterval, numRollingMonths int) (*scraper.Statistics, error) {
+func getKilonovaExcludedCounts(ctx context.Context, conn *pgx.Conn, e *scraper.Exclusions) ([]scraper.ExcludedCount, error) {
+	var counts []scraper.ExcludedCount
+	for _, rule := range e.Rules() {
+		var args []any
+		cond := kilonovaRuleCond(rule, &args)
+		var cnt int
+		if err := conn.QueryRow(ctx, "SELECT COUNT(*) FROM submissions WHERE "+cond, args...).Scan(&cnt); err != nil {
+			return nil, err
+		}
+		counts = append(counts, scraper.ExcludedCount{Rule: rule.String(), Count: cnt})
+	}
+	return counts, nil
+}
+
+// kilonovaProblemURL links to a Kilonova problem
+func kilonovaProblemURL(problemID string) string {
+	return "https://kilonova.ro/problems/" + problemID
+}
+
+// getKilonovaProblemActivity counts the submissions, users and solving users of each problem in [from, to)
+func getKilonovaProblemActivity(ctx context.Context, conn *pgx.Conn, from, to time.Time, exclude *scraper.Exclusions) ([]scraper.LeaderboardEntry, error) {
+	args := []any{from, to}
+	exclCond := kilonovaExclusionsCond(exclude, &args)
+	rows, _ := conn.Query(ctx, `SELECT
+		agg.problem_id::text AS id,
+		COALESCE(problems.name, '') AS name,
+		agg.submissions, agg.attempted, agg.solved
+	FROM (
+		SELECT
+			problem_id,
+			COUNT(*) AS submissions,
+			COUNT(DISTINCT user_id) AS attempted,
+			COUNT(DISTINCT user_id) FILTER (WHERE score = 100) AS solved
+		FROM submissions
+		WHERE created_at >= $1 AND created_at < $2 AND `+exclCond+`
+		GROUP BY problem_id
+	) agg LEFT JOIN problems ON problems.id = agg.problem_id
+	`, args...)
+	problems, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[scraper.LeaderboardEntry])
+	if err != nil {
+		return nil, err
+	}
+	for i := range problems {
+		problems[i].URL = kilonovaProblemURL(problems[i].ID)
+	}
+	return problems, nil
+}
+
+func getKilonovaLeaderboards(ctx context.Context, conn *pgx.Conn, opts scraper.LeaderboardOptions, loc *time.Location, exclude *scraper.Exclusions) ([]*scraper.Leaderboard, error) {
+	var boards []*scraper.Leaderboard
+	for _, period := range opts.LeaderboardPeriods(loc) {
+		problems, err := getKilonovaProblemActivity(ctx, conn, period[0], period[1], exclude)
+		if err != nil {
+			return nil, err
+		}
+
+		args := []any{period[0], period[1]}
+		exclCond := kilonovaExclusionsCond(exclude, &args)
+		rows, _ := conn.Query(ctx, `SELECT
+			agg.user_id::text AS id,
+			COALESCE(users.name, '') AS name,
+			agg.submissions, agg.attempted, agg.solved
+		FROM (
+			SELECT
+				user_id,
+				COUNT(*) AS submissions,
+				COUNT(DISTINCT problem_id) AS attempted,
+				COUNT(DISTINCT problem_id) FILTER (WHERE score = 100) AS solved
+			FROM submissions
+			WHERE created_at >= $1 AND created_at < $2 AND `+exclCond+`
+			GROUP BY user_id
+		) agg LEFT JOIN users ON users.id = agg.user_id
+		`, args...)
+		users, err := pgx.CollectRows(rows, pgx.RowToStructByNameLax[scraper.LeaderboardEntry])
+		if err != nil {
+			return nil, err
+		}
+
+		boards = append(boards, scraper.BuildLeaderboard(opts.Granularity, period[0], period[1], problems, users, opts.TopN))
+	}
+	return boards, nil
+}
+
+// connectKilonova connects to the Kilonova database, with timestamps in UTC
+func connectKilonova(ctx context.Context, dsn string) (*pgx.Conn, error) {
 	config, err := pgx.ParseConfig(dsn)
 	if err != nil {
 		return nil, err
 	}
 	config.RuntimeParams["timezone"] = "UTC"
-	conn, err := pgx.ConnectConfig(ctx, config)
+	return pgx.ConnectConfig(ctx, config)
+}
+
+// KilonovaDB computes the Kilonova statistics straight from its database
+type KilonovaDB struct {
+	DSN string
+}
+
+var _ scraper.StatsSource = &KilonovaDB{}
+
+func (k *KilonovaDB) Platform() string {
+	return Kilonova
+}
+
+func (k *KilonovaDB) Statistics(ctx context.Context, opts scraper.StatsOptions) (*scraper.Statistics, error) {
+	return GetKilonovaStats(ctx, k.DSN, opts)
+}
+
+func GetKilonovaStats(ctx context.Context, dsn string, opts scraper.StatsOptions) (*scraper.Statistics, error) {
+	conn, err := connectKilonova(ctx, dsn)
 	if err != nil {
 		return nil, err
 	}
 	defer conn.Close(context.Background())
 
-	dayStats, err := getStats(ctx, conn, `WITH starting_data AS (
-		SELECT user_id, problem_id, DATE_TRUNC('day', created_at AT TIME ZONE 'UTC', 'UTC') AS day FROM submissions WHERE user_id <> 2951
-	   ) SELECT 
-			$2 AS platform_name,
-	   		COUNT(*) AS num_submissions, 
-			COUNT(DISTINCT (user_id, problem_id)) AS excluding_multiple, 
-			COUNT(DISTINCT user_id) AS unique_users, 
-			COUNT(DISTINCT problem_id) AS unique_problems, 
-			day AS time
-			FROM starting_data GROUP BY day ORDER BY day DESC
-		LIMIT $1
-	`, numDays, Kilonova)
+	dayQuery, monthQuery, rollingQuery := opts.Queries()
+	dayStats, err := kilonovaEngine(conn).Stats(ctx, dayQuery)
 	if err != nil {
 		return nil, err
 	}
 
-	monthStats, err := getStats(ctx, conn, `WITH starting_data AS (
-		SELECT user_id, problem_id, DATE_TRUNC('month', created_at AT TIME ZONE 'UTC', 'UTC') AS day FROM submissions WHERE user_id <> 2951
-	   ) SELECT 
-	   		$2 AS platform_name,
-	   		COUNT(*) AS num_submissions, 
-			COUNT(DISTINCT (user_id, problem_id)) AS excluding_multiple, 
-			COUNT(DISTINCT user_id) AS unique_users, 
-			COUNT(DISTINCT problem_id) AS unique_problems, 
-			day AS time
-			FROM starting_data GROUP BY day ORDER BY day DESC
-		LIMIT $1`, numMonths, Kilonova)
+	monthStats, err := kilonovaEngine(conn).Stats(ctx, monthQuery)
 	if err != nil {
 		return nil, err
 	}
 
-	rollingMonthStats, err := getStats(ctx, conn, `WITH starting_data AS (
-		SELECT user_id, problem_id, 
-			DATE_BIN(($1 || ' days')::interval,
-				DATE_TRUNC('day', created_at AT TIME ZONE 'UTC', 'UTC'),
-				DATE_TRUNC('day', NOW() AT TIME ZONE 'UTC', 'UTC') + '1 day'::interval	
-			) AS day FROM submissions WHERE user_id <> 2951
-	   ) SELECT 
-	   		$3 AS platform_name,
-	   		COUNT(*) AS num_submissions, 
-			COUNT(DISTINCT (user_id, problem_id)) AS excluding_multiple, 
-			COUNT(DISTINCT user_id) AS unique_users, 
-			COUNT(DISTINCT problem_id) AS unique_problems, 
-			day AS time
-			FROM starting_data GROUP BY day ORDER BY day DESC
-		LIMIT $2`, strconv.Itoa(rollInterval), numRollingMonths, Kilonova)
+	rollingMonthStats, err := kilonovaEngine(conn).Stats(ctx, rollingQuery)
 	if err != nil {
 		return nil, err
 	}
 
+	var extraStats []*scraper.PeriodStats
+	for _, q := range opts.Extra {
+		q.Exclude = opts.Exclude
+		rows, err := kilonovaEngine(conn).Stats(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		from, to := q.Range(time.Now())
+		extraStats = append(extraStats, &scraper.PeriodStats{Granularity: q.Granularity, From: from, To: to, Rows: rows})
+	}
+
+	excluded, err := getKilonovaExcludedCounts(ctx, conn, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var cohorts []scraper.Cohort
+	if opts.NumCohorts > 0 {
+		q := scraper.CohortsQuery(opts.NumCohorts, opts.Location, opts.Exclude)
+		from, to := q.Range(time.Now())
+		activity, err := kilonovaEngine(conn).UserActivity(ctx, q, from, to)
+		if err != nil {
+			return nil, err
+		}
+		cohorts = scraper.ComputeCohorts(activity, q.Loc())
+	}
+
+	var leaderboards []*scraper.Leaderboard
+	if opts.Leaderboards.TopN > 0 {
+		leaderboards, err = getKilonovaLeaderboards(ctx, conn, opts.Leaderboards, opts.Location, opts.Exclude)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var heatmap *scraper.Heatmap
+	if opts.HeatmapDays > 0 {
+		q := scraper.HeatmapQuery(opts.HeatmapDays, opts.Location, opts.Exclude)
+		rows, err := kilonovaEngine(conn).Stats(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		heatmap = scraper.HeatmapFromHourly(q, rows)
+	}
+
 	var lastTime time.Time
 	if err := conn.QueryRow(ctx, "SELECT MAX(created_at) AT TIME ZONE 'UTC' FROM submissions").Scan(&lastTime); err != nil {
 		return nil, err
@@ -103,15 +308,71 @@ func GetKilonovaStats(ctx context.Context, dsn string, numDays, numMonths, rollI
 		DayStats:           dayStats,
 		RollingMonthsStats: rollingMonthStats,
 		MonthsStats:        monthStats,
+		ExtraStats:         extraStats,
+
+		Excluded:     excluded,
+		Cohorts:      cohorts,
+		Leaderboards: leaderboards,
+		Heatmap:      heatmap,
 	}, nil
 }
 
+func (k *KilonovaDB) UserSummaries(ctx context.Context, exclude *scraper.Exclusions) ([]scraper.UserSummary, error) {
+	conn, err := connectKilonova(ctx, k.DSN)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+
+	var args []any
+	exclCond := kilonovaExclusionsCond(exclude, &args)
+	rows, _ := conn.Query(ctx, `SELECT
+		users.name AS username,
+		COALESCE(users.display_name, '') AS display_name,
+		agg.submissions, agg.first_submission, agg.last_submission
+	FROM (
+		SELECT user_id, COUNT(*) AS submissions, MIN(created_at) AS first_submission, MAX(created_at) AS last_submission
+		FROM submissions WHERE `+exclCond+` GROUP BY user_id
+	) agg INNER JOIN users ON users.id = agg.user_id
+	`, args...)
+	return pgx.CollectRows(rows, pgx.RowToStructByName[scraper.UserSummary])
+}
+
+func (k *KilonovaDB) ProblemActivity(ctx context.Context, from, to time.Time, exclude *scraper.Exclusions) ([]scraper.LeaderboardEntry, error) {
+	conn, err := connectKilonova(ctx, k.DSN)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+	return getKilonovaProblemActivity(ctx, conn, from, to, exclude)
+}
+
 type daysStruct struct {
+	// Start of the period, in the reporting timezone (the name predates timezone support)
 	DayUTC time.Time
 
+	// One entry per platform, in the same order as Config.Platforms. nil if the platform has no data for the period
 	Platforms []*scraper.StatsRow
 }
 
+// extraTable holds the aligned statistics of an additional granularity
+type extraTable struct {
+	Granularity scraper.Granularity
+	// Queried range. A zero From means since the first submission
+	From time.Time
+	To   time.Time
+
+	Rows []daysStruct
+}
+
+// RangeLabel describes the queried range, such as "from 2023-09-01 to 2024-07-01"
+func (t extraTable) RangeLabel() string {
+	if t.From.IsZero() {
+		return "until " + t.To.Format(time.DateOnly)
+	}
+	return "from " + t.From.Format(time.DateOnly) + " to " + t.To.Format(time.DateOnly)
+}
+
 type Config struct {
 	Platforms []*scraper.Statistics
 	NumDays   int
@@ -119,27 +380,57 @@ type Config struct {
 
 	RollingInterval  int
 	NumRollingMonths int
+	NumCohorts       int
 
 	ShowWaitingDisclaimer bool
 	ShowCSADisclaimer     bool
+
+	// Path to a template overriding the embedded templ.body. Empty means the embedded one
+	TemplatePath string
+	// Wrap the stats body in a full HTML page with inline CSS, which can be opened on its own
+	Standalone bool
+	// Embed SVG charts above the tables
+	ShowCharts bool
+	// Add verdict breakdown columns (full scores, error rates, score mean/median, solved pairs) to the tables
+	ShowVerdicts bool
+
+	// Additional granularities, in the same order as each platform's ExtraStats
+	ExtraQueries []scraper.StatsQuery
+
+	// Reporting timezone. nil means UTC
+	Location *time.Location
+}
+
+func (c *Config) Loc() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+// Timezone returns the name of the reporting timezone, for labels
+func (c *Config) Timezone() string {
+	return c.Loc().String()
 }
 
 func convertStats(platforms [][]*scraper.StatsRow, order []string) []daysStruct {
-	var days = make(map[time.Time]map[string]*scraper.StatsRow)
+	var days = make(map[int64]map[string]*scraper.StatsRow)
+	var starts = make(map[int64]time.Time)
 
 	for _, platform := range platforms {
 		for _, day := range platform {
-			d := days[day.Time.UTC()]
+			d := days[day.Time.Unix()]
 			if d == nil {
 				d = make(map[string]*scraper.StatsRow)
 			}
 			d[day.PlatformName] = day
-			days[day.Time.UTC()] = d
+			days[day.Time.Unix()] = d
+			starts[day.Time.Unix()] = day.Time
 		}
 	}
 
 	var days2 []daysStruct
-	for dUtc, val := range days {
+	for start, val := range days {
 		p := make([]*scraper.StatsRow, len(order))
 		for i := range order {
 			day, ok := val[order[i]]
@@ -148,7 +439,7 @@ func convertStats(platforms [][]*scraper.StatsRow, order []string) []daysStruct
 			}
 		}
 		days2 = append(days2, daysStruct{
-			DayUTC:    dUtc,
+			DayUTC:    starts[start],
 			Platforms: p,
 		})
 	}
@@ -165,33 +456,67 @@ func convertStats(platforms [][]*scraper.StatsRow, order []string) []daysStruct
 	return days2
 }
 
+// allStats aligns the platforms for every granularity
+func allStats(conf *Config) (days, months, rolling []daysStruct) {
+	return convertStats(getDayStats(conf.Platforms)), convertStats(getMonthStats(conf.Platforms)), convertStats(getRollingMonthStats(conf.Platforms))
+}
+
+// extraStats aligns the platforms for every additional granularity
+func extraStats(conf *Config) []extraTable {
+	tables := make([]extraTable, 0, len(conf.ExtraQueries))
+	for i, q := range conf.ExtraQueries {
+		from, to := q.Range(time.Now())
+		tables = append(tables, extraTable{
+			Granularity: q.Granularity,
+			From:        from,
+			To:          to,
+			Rows:        convertStats(getExtraStats(conf.Platforms, i)),
+		})
+	}
+	return tables
+}
+
 func ExportToVROBody(ctx context.Context, conf *Config, w io.Writer) error {
 	var names []string
 	for _, pl := range conf.Platforms {
 		names = append(names, pl.PlatformName)
 	}
 
-	args := struct {
-		*Config
-
-		LastUpdatedAt time.Time
-		H1Name        string
+	t, err := loadTemplate(conf.TemplatePath, conf.Standalone)
+	if err != nil {
+		return err
+	}
 
-		DaysStats          []daysStruct
-		MonthsStats        []daysStruct
-		RollingMonthsStats []daysStruct
-	}{
+	args := TemplateData{
 		H1Name: strings.Join(names, "/"),
 		Config: conf,
 
-		LastUpdatedAt: time.Now().UTC(),
+		LastUpdatedAt: time.Now().In(conf.Loc()),
+	}
+	args.DaysStats, args.MonthsStats, args.RollingMonthsStats = allStats(conf)
+	args.ExtraStats = extraStats(conf)
 
-		DaysStats:          convertStats(getDayStats(conf.Platforms)),
-		MonthsStats:        convertStats(getMonthStats(conf.Platforms)),
-		RollingMonthsStats: convertStats(getRollingMonthStats(conf.Platforms)),
+	if conf.ShowCharts {
+		args.Charts = Charts{
+			DailySubmissions: lineChart("Daily submissions", args.DaysStats, names, "Jan 02", func(r *scraper.StatsRow) int {
+				return r.NumSubmissions
+			}),
+			ActiveUsers: lineChart("Monthly active users (trailing 30 days)", args.DaysStats, names, "Jan 02", func(r *scraper.StatsRow) int {
+				if r.MonthlyActiveUsers == nil {
+					return 0
+				}
+				return *r.MonthlyActiveUsers
+			}),
+			MonthlyUsers: barChart("Monthly unique users", args.MonthsStats, names, "Jan 2006", func(r *scraper.StatsRow) int {
+				return r.UniqueUsers
+			}),
+			RollingSubmissions: barChart(fmt.Sprintf("Submissions per %d-day interval", conf.RollingInterval), args.RollingMonthsStats, names, "Jan 02", func(r *scraper.StatsRow) int {
+				return r.NumSubmissions
+			}),
+		}
 	}
 
-	return templ.Execute(w, args)
+	return t.ExecuteTemplate(w, execTemplateName(conf.Standalone), args)
 }
 
 func getDayStats(p []*scraper.Statistics) ([][]*scraper.StatsRow, []string) {
@@ -212,6 +537,18 @@ func getMonthStats(p []*scraper.Statistics) ([][]*scraper.StatsRow, []string) {
 	}
 	return rrows, order
 }
+func getExtraStats(p []*scraper.Statistics, i int) ([][]*scraper.StatsRow, []string) {
+	rrows := make([][]*scraper.StatsRow, len(p))
+	order := make([]string, len(p))
+	for j := range p {
+		if i < len(p[j].ExtraStats) {
+			rrows[j] = p[j].ExtraStats[i].Rows
+		}
+		order[j] = p[j].PlatformName
+	}
+	return rrows, order
+}
+
 func getRollingMonthStats(p []*scraper.Statistics) ([][]*scraper.StatsRow, []string) {
 	rrows := make([][]*scraper.StatsRow, len(p))
 	order := make([]string, len(p))
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+var updateGolden = flag.Bool("update", false, "Rewrite the golden files of the tests")
+
+// Postgres database the Kilonova queries are tested on. The test tables are temporary, so any database works
+const kilonovaTestDSN = "KILONOVA_TEST_DSN"
+
+// fixtureSubmission is a submission of testdata/stats_fixture.json.
+// Kilonova has no internal errors or ignored submissions, so the fixture has none either
+type fixtureSubmission struct {
+	ID           int       `json:"id"`
+	User         string    `json:"user"`
+	Problem      int       `json:"problem"`
+	Date         time.Time `json:"date"`
+	Score        *int      `json:"score"`
+	CompileError bool      `json:"compile_error"`
+}
+
+func loadFixture(t *testing.T) []fixtureSubmission {
+	t.Helper()
+	data, err := os.ReadFile("testdata/stats_fixture.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subs []fixtureSubmission
+	if err := json.Unmarshal(data, &subs); err != nil {
+		t.Fatal(err)
+	}
+	return subs
+}
+
+// statsBackend computes the statistics of the fixture on one database
+type statsBackend struct {
+	name  string
+	stats func(ctx context.Context, q scraper.StatsQuery) ([]*scraper.StatsRow, error)
+}
+
+func sqliteBackend(t *testing.T, subs []fixtureSubmission) statsBackend {
+	t.Helper()
+	db, err := scraper.NewDB(Kilonova, filepath.Join(t.TempDir(), "dump.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page []*scraper.Submission
+	for _, sub := range subs {
+		problem := strconv.Itoa(sub.Problem)
+		page = append(page, &scraper.Submission{
+			ID:           sub.ID,
+			Username:     sub.User,
+			DisplayName:  sub.User,
+			ProblemID:    &problem,
+			ProblemName:  &problem,
+			Date:         sub.Date,
+			CompileError: sub.CompileError,
+			Score:        sub.Score,
+			Handled:      true,
+		})
+	}
+	if _, err := db.InsertMonitorPage(context.Background(), page); err != nil {
+		t.Fatal(err)
+	}
+	return statsBackend{name: "sqlite", stats: db.GetStats}
+}
+
+// postgresBackend loads the fixture into temporary tables shaped like the Kilonova ones, which shadow the real tables on the connection
+func postgresBackend(t *testing.T, dsn string, subs []fixtureSubmission) statsBackend {
+	t.Helper()
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close(ctx) })
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TEMP TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+		CREATE TEMP TABLE submissions (
+			id INTEGER PRIMARY KEY,
+			created_at TIMESTAMPTZ NOT NULL,
+			user_id INTEGER NOT NULL,
+			problem_id INTEGER NOT NULL,
+			score INTEGER,
+			compile_error BOOLEAN
+		)`); err != nil {
+		t.Fatal(err)
+	}
+	userIDs := make(map[string]int)
+	for _, sub := range subs {
+		id, ok := userIDs[sub.User]
+		if !ok {
+			id = len(userIDs) + 1
+			userIDs[sub.User] = id
+			if _, err := conn.Exec(ctx, "INSERT INTO users (id, name) VALUES ($1, $2)", id, sub.User); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := conn.Exec(ctx, "INSERT INTO submissions (id, created_at, user_id, problem_id, score, compile_error) VALUES ($1, $2, $3, $4, $5, $6)",
+			sub.ID, sub.Date, id, sub.Problem, sub.Score, sub.CompileError); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return statsBackend{name: "postgres", stats: kilonovaEngine(conn).Stats}
+}
+
+func bucharest(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Bucharest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// goldenQueries covers the granularities over the fixture's range, which spans both DST changes of 2024
+func goldenQueries(t *testing.T) map[string]scraper.StatsQuery {
+	t.Helper()
+	loc := bucharest(t)
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, loc)
+	to := time.Date(2024, 11, 4, 0, 0, 0, 0, loc)
+	query := func(gran string, loc *time.Location, exclude *scraper.Exclusions) scraper.StatsQuery {
+		g, err := scraper.ParseGranularity(gran)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return scraper.StatsQuery{Granularity: g, From: from, To: to, Location: loc, Exclude: exclude, UserActivity: true}
+	}
+	return map[string]scraper.StatsQuery{
+		"day_utc":      query("day", time.UTC, nil),
+		"day":          query("day", loc, nil),
+		"week":         query("week", loc, nil),
+		"month":        query("month", loc, nil),
+		"rolling_7d":   query("7d", loc, nil),
+		"rolling_30d":  query("30d", loc, nil),
+		"day_excluded": query("day", loc, &scraper.Exclusions{Users: []string{"bot"}, Problems: []string{"3"}, CompileErrors: true}),
+	}
+}
+
+func TestStatsGolden(t *testing.T) {
+	sqlite := sqliteBackend(t, loadFixture(t))
+	queries := goldenQueries(t)
+	ctx := context.Background()
+
+	const goldenPath = "testdata/stats_golden.json"
+	got := make(map[string][]*scraper.StatsRow)
+	for name, q := range queries {
+		rows, err := sqlite.stats(ctx, q)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got[name] = rows
+	}
+	if *updateGolden {
+		data, err := json.MarshalIndent(got, "", "\t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(goldenPath, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden := make(map[string][]*scraper.StatsRow)
+	data, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &golden); err != nil {
+		t.Fatal(err)
+	}
+	for name := range queries {
+		gotJSON, _ := json.MarshalIndent(got[name], "", "\t")
+		wantJSON, _ := json.MarshalIndent(golden[name], "", "\t")
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("%s differs from %s:\ngot  %s\nwant %s", name, goldenPath, gotJSON, wantJSON)
+		}
+	}
+}
+
+// TestStatsParity checks that the Kilonova queries on Postgres return the same rows as the SQLite ones, for the fixture and the boundary submissions
+func TestStatsParity(t *testing.T) {
+	dsn := os.Getenv(kilonovaTestDSN)
+	if dsn == "" {
+		t.Skipf("%s is not set, set it to a Postgres database to compare the Kilonova queries with SQLite", kilonovaTestDSN)
+	}
+	ctx := context.Background()
+	for _, fixture := range []struct {
+		name    string
+		subs    []fixtureSubmission
+		queries map[string]scraper.StatsQuery
+	}{
+		{"fixture", loadFixture(t), goldenQueries(t)},
+		{"boundaries", boundarySubmissions(t), boundaryQueries(t)},
+	} {
+		sqlite, pg := sqliteBackend(t, fixture.subs), postgresBackend(t, dsn, fixture.subs)
+		for name, q := range fixture.queries {
+			for _, activity := range []bool{true, false} {
+				q.UserActivity = activity
+				want, err := sqlite.stats(ctx, q)
+				if err != nil {
+					t.Fatalf("%s %s: %v", fixture.name, name, err)
+				}
+				got, err := pg.stats(ctx, q)
+				if err != nil {
+					t.Fatalf("%s %s: %v", fixture.name, name, err)
+				}
+				gotJSON, _ := json.MarshalIndent(got, "", "\t")
+				wantJSON, _ := json.MarshalIndent(want, "", "\t")
+				if string(gotJSON) != string(wantJSON) {
+					t.Errorf("%s %s (user activity %t): postgres differs from sqlite:\npostgres %s\nsqlite   %s", fixture.name, name, activity, gotJSON, wantJSON)
+				}
+			}
+		}
+	}
+}
+
+// boundarySubmissions are submissions around midnight and the DST changes of 2024 in Europe/Bucharest
+func boundarySubmissions(t *testing.T) []fixtureSubmission {
+	t.Helper()
+	loc := bucharest(t)
+	local := func(month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(2024, month, day, hour, min, sec, 0, loc)
+	}
+	// The repeated hour when the clocks go back on 2024-10-27: 03:30 EEST and 03:30 EET
+	fallBack := time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC)
+	dates := []time.Time{
+		local(3, 30, 23, 59, 59),
+		local(3, 31, 0, 0, 0),
+		local(3, 31, 2, 59, 59), // the clocks go forward to 04:00
+		local(3, 31, 4, 0, 0),
+		local(10, 20, 23, 59, 59),
+		local(10, 21, 0, 0, 0),
+		fallBack,
+		fallBack.Add(time.Hour),
+		local(10, 27, 23, 59, 59),
+		local(10, 28, 0, 0, 0),
+	}
+	var subs []fixtureSubmission
+	for i, date := range dates {
+		score := 100
+		subs = append(subs, fixtureSubmission{ID: i + 1, User: "ana", Problem: 1, Date: date, Score: &score})
+	}
+	return subs
+}
+
+// boundaryQueries end on a monday, so rolling windows start on mondays at local midnight on both sides of the DST changes
+func boundaryQueries(t *testing.T) map[string]scraper.StatsQuery {
+	t.Helper()
+	loc := bucharest(t)
+	queries := make(map[string]scraper.StatsQuery)
+	for _, gran := range []string{"day", "7d", "30d"} {
+		g, err := scraper.ParseGranularity(gran)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queries[gran] = scraper.StatsQuery{
+			Granularity: g,
+			From:        time.Date(2024, 3, 1, 0, 0, 0, 0, loc),
+			To:          time.Date(2024, 11, 4, 0, 0, 0, 0, loc),
+			Location:    loc,
+		}
+	}
+	return queries
+}
+
+// TestStatsBoundaries checks the periods that submissions around midnight and the DST changes fall in
+func TestStatsBoundaries(t *testing.T) {
+	loc := bucharest(t)
+	local := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 0, 0, 0, 0, loc)
+	}
+	sqlite := sqliteBackend(t, boundarySubmissions(t))
+	queries := boundaryQueries(t)
+	for gran, want := range map[string]map[time.Time]int{
+		// Number of submissions in each period, by the local start of the period
+		"day": {
+			local(3, 30):  1,
+			local(3, 31):  3, // a 23 hour day
+			local(10, 20): 1,
+			local(10, 21): 1,
+			local(10, 27): 3, // a 25 hour day
+			local(10, 28): 1,
+		},
+		"7d": {
+			local(3, 25):  4,
+			local(10, 14): 1,
+			local(10, 21): 4,
+			local(10, 28): 1,
+		},
+		"30d": {
+			local(3, 9):  4,
+			local(10, 5): 6,
+		},
+	} {
+		rows, err := sqlite.stats(context.Background(), queries[gran])
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Keyed by unix time, since the locations of the rows and of want are loaded separately
+		got := make(map[int64]int)
+		for _, row := range rows {
+			got[row.Time.Unix()] = row.NumSubmissions
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: got %d periods, want %d: %v", gran, len(got), len(want), got)
+		}
+		for start, n := range want {
+			if got[start.Unix()] != n {
+				t.Errorf("%s: period starting %s has %d submissions, want %d", gran, start, got[start.Unix()], n)
+			}
+		}
+	}
+}
+
+// TestStatsWithoutUserActivity checks that the user activity is only computed for the queries asking for it
+func TestStatsWithoutUserActivity(t *testing.T) {
+	sqlite := sqliteBackend(t, loadFixture(t))
+	for name, q := range goldenQueries(t) {
+		q.UserActivity = false
+		rows, err := sqlite.stats(context.Background(), q)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, row := range rows {
+			if row.NewUsers != 0 || row.ReturningUsers != 0 || row.ChurnedUsers != nil || row.MonthlyActiveUsers != nil {
+				t.Fatalf("%s: got user activity for the period starting %s", name, row.Time)
+			}
+		}
+	}
+}
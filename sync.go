@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+// syncer is a scraper of any offset type
+type syncer interface {
+	Sync(ctx context.Context, opts scraper.SyncOptions) (*scraper.SyncSummary, error)
+}
+
+// parseUntil parses the until bound of a sync: a submission ID, or a date (YYYY-MM-DD), date and time (YYYY-MM-DD HH:MM:SS) or RFC 3339 time
+func parseUntil(s string, loc *time.Location, opts *scraper.SyncOptions) error {
+	if s == "" {
+		return nil
+	}
+	if id, err := strconv.Atoi(s); err == nil {
+		opts.UntilID = id
+		return nil
+	}
+	for _, layout := range []string{time.DateOnly, time.DateTime} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			opts.UntilTime = t
+			return nil
+		}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return fmt.Errorf("invalid until bound %q: expected a submission ID or a time", s)
+	}
+	opts.UntilTime = t
+	return nil
+}
+
+func writeSyncSummaries(w io.Writer, summaries []*scraper.SyncSummary, output string) error {
+	if output == OutputJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(summaries)
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PLATFORM\tPAGES\tFETCHED\tINSERTED\tUPDATED\tUNCHANGED\tSKIPPED\tOFFSETS\tIDS\tSTOP")
+	for _, s := range summaries {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s - %s\t%d - %d\t%s\n",
+			s.Platform, s.Pages, s.Fetched, s.Inserted, s.Updated, s.Unchanged, s.Skipped,
+			s.StartOffset, s.EndOffset, s.NewestID, s.OldestID, s.StopReason)
+	}
+	var changes bool
+	for _, s := range summaries {
+		changes = changes || len(s.Changes) > 0
+	}
+	if changes {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "PLATFORM\tID\tACTION\tFIELDS")
+		for _, s := range summaries {
+			for _, c := range s.Changes {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", s.Platform, c.ID, c.Action, strings.Join(c.Fields, ","))
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// parseSyncArgs parses the flags of the sync subcommand. main needs them before opening the dumps, which dry runs open read-only
+func parseSyncArgs(args []string, loc *time.Location) (scraper.SyncOptions, error) {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	until := fs.String("until", "", "Stop at the first submission with a lower ID, or older than a time (YYYY-MM-DD, YYYY-MM-DD HH:MM:SS in the reporting timezone, or RFC 3339)")
+	maxPages := fs.Int("max-pages", 0, "Fetch at most x pages from each platform, 0 means no limit")
+	dryRun := fs.Bool("dry-run", false, "Fetch and parse, but write nothing, printing what would be inserted or updated")
+	backlog := fs.Bool("backlog", false, "Continue the backlog from the furthest scraped offset instead of scraping the newest submissions")
+	if err := fs.Parse(args); err != nil {
+		return scraper.SyncOptions{}, err
+	}
+	opts := scraper.SyncOptions{Backlog: *backlog, MaxPages: *maxPages, DryRun: *dryRun}
+	if err := parseUntil(*until, loc, &opts); err != nil {
+		return scraper.SyncOptions{}, err
+	}
+	return opts, nil
+}
+
+// runSync runs the sync subcommand: a bounded scrape of the enabled platforms, optionally without writing anything
+func runSync(ctx context.Context, opts scraper.SyncOptions, scrapers []syncer, w io.Writer) error {
+	switch *output {
+	case OutputTable, OutputJSON:
+	default:
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	var summaries []*scraper.SyncSummary
+	for _, sc := range scrapers {
+		summary, err := sc.Sync(ctx, opts)
+		if err != nil {
+			return err
+		}
+		summaries = append(summaries, summary)
+	}
+	return writeSyncSummaries(w, summaries, *output)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "embed"
+)
+
+//go:embed templ.body
+var templData string
+
+//go:embed templ.page
+var pageTemplData string
+
+var templateFuncs = template.FuncMap{
+	"formatNumber": formatNumber,
+	"percent":      percent,
+	"delta":        delta,
+	"change":       change,
+	"trend":        trend,
+	"heat":         heat,
+	"seq":          seq,
+	"heatmap":      heatmapChart,
+}
+
+var (
+	templ = template.Must(newTemplate(templData, false))
+)
+
+// TemplateData is what the stats template (the embedded templ.body, or the file given with -template) is executed with.
+//
+// It is a stable contract for user-supplied templates: fields may be added over time, but existing ones
+// will not be renamed, removed or change meaning. The same goes for the fields of the embedded Config,
+// daysStruct and scraper.StatsRow/scraper.Statistics.
+type TemplateData struct {
+	// Export parameters, including the per-platform totals in Config.Platforms
+	*Config
+
+	// When the export was generated, in the reporting timezone (see Config.Timezone)
+	LastUpdatedAt time.Time
+	// Platform names joined by "/"
+	H1Name string
+
+	// Per-day statistics, newest first
+	DaysStats []daysStruct
+	// Per-calendar-month statistics, newest first
+	MonthsStats []daysStruct
+	// Per-rolling-interval statistics (of Config.RollingInterval days), newest first
+	RollingMonthsStats []daysStruct
+	// Statistics for the granularities in Config.ExtraQueries, newest first.
+	// Use {{.Granularity.Label .DayUTC}} to format the periods
+	ExtraStats []extraTable
+
+	// Inline SVG charts of the above statistics, if enabled through Config.ShowCharts
+	Charts Charts
+}
+
+// newTemplate parses a stats body template. If standalone is set, the body is wrapped in a full HTML page with inline styling.
+// The resulting template must be run with ExecuteTemplate(w, execTemplateName(standalone), data).
+func newTemplate(body string, standalone bool) (*template.Template, error) {
+	t, err := template.New("stats_body").Funcs(templateFuncs).Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	if standalone {
+		if _, err := t.New("page").Parse(pageTemplData); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func execTemplateName(standalone bool) string {
+	if standalone {
+		return "page"
+	}
+	return "stats_body"
+}
+
+func loadTemplate(path string, standalone bool) (*template.Template, error) {
+	if path == "" {
+		if !standalone {
+			return templ, nil
+		}
+		return newTemplate(templData, true)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newTemplate(string(data), standalone)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse template %q: %w", path, err)
+	}
+	return t, nil
+}
+
+func toFloat(val any) (float64, bool) {
+	switch v := val.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case *int:
+		if v == nil {
+			return 0, false
+		}
+		return float64(*v), true
+	case *float64:
+		if v == nil {
+			return 0, false
+		}
+		return *v, true
+	}
+	return 0, false
+}
+
+// formatNumber renders a number with comma thousands separators. Floats are rounded to 2 decimals.
+func formatNumber(val any) string {
+	f, ok := toFloat(val)
+	if !ok {
+		return "N/A"
+	}
+	var s string
+	if f == math.Trunc(f) {
+		s = strconv.FormatFloat(f, 'f', 0, 64)
+	} else {
+		s = strconv.FormatFloat(f, 'f', 2, 64)
+	}
+
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	intPart, fracPart, hasFrac := strings.Cut(s, ".")
+	var sb strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(c)
+	}
+	if hasFrac {
+		sb.WriteByte('.')
+		sb.WriteString(fracPart)
+	}
+	return sign + sb.String()
+}
+
+// percent renders part/total as a percentage with one decimal
+func percent(part, total any) string {
+	p, ok1 := toFloat(part)
+	t, ok2 := toFloat(total)
+	if !ok1 || !ok2 || t == 0 {
+		return "N/A"
+	}
+	return strconv.FormatFloat(p/t*100, 'f', 1, 64) + "%"
+}
+
+// delta renders the signed difference between cur and prev, alongside the relative change
+func delta(cur, prev any) string {
+	c, ok1 := toFloat(cur)
+	p, ok2 := toFloat(prev)
+	if !ok1 || !ok2 {
+		return "N/A"
+	}
+	diff := formatNumber(c - p)
+	if c-p >= 0 {
+		diff = "+" + diff
+	}
+	if p == 0 {
+		return diff
+	}
+	rel := strconv.FormatFloat((c-p)/p*100, 'f', 1, 64)
+	if c-p >= 0 {
+		rel = "+" + rel
+	}
+	return diff + " (" + rel + "%)"
+}
+
+// change renders the signed change like delta, given the current value and the difference from the previous one
+func change(cur, diff int) string {
+	return delta(cur, cur-diff)
+}
+
+// trend renders an up or down indicator for a difference, with the full change as tooltip
+func trend(cur, diff int) template.HTML {
+	var arrow, color string
+	switch {
+	case diff > 0:
+		arrow, color = "\u25B2", "#198754"
+	case diff < 0:
+		arrow, color = "\u25BC", "#dc3545"
+	default:
+		arrow, color = "\u25B6", "#6c757d"
+	}
+	return template.HTML(`<span style="color:` + color + `" title="` + template.HTMLEscapeString(change(cur, diff)+" vs. previous period") + `">` + arrow + `</span>`)
+}
+
+// heat colors a table cell by a share from 0 to 1, from white to green
+func heat(share float64) template.CSS {
+	return template.CSS(fmt.Sprintf("background-color: rgba(25, 135, 84, %.2f)", math.Max(0, math.Min(share, 1))))
+}
+
+// seq returns the numbers from 0 to n-1, none if n is negative
+func seq(n int) []int {
+	s := make([]int, max(n, 0))
+	for i := range s {
+		s[i] = i
+	}
+	return s
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSeq(t *testing.T) {
+	for n, want := range map[int][]int{-3: {}, 0: {}, 3: {0, 1, 2}} {
+		if got := seq(n); !slices.Equal(got, want) {
+			t.Errorf("seq(%d) = %v, want %v", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"time"
+
+	"vasiluta.ro/ia_kn_stats/scraper"
+)
+
+// Number of periods to query beyond the exported ones, so that the oldest exported periods also get trend data
+const (
+	lookbackDays    = movingAvgDays
+	lookbackMonths  = 12
+	lookbackRolling = 1
+)
+
+// prepareStats fills in the trend data (deltas, moving averages) of all rows,
+// then trims the statistics of each platform down to the exported number of periods.
+func prepareStats(conf *Config) {
+	days, months, rolling := allStats(conf)
+
+	attachDeltas(days, func(t time.Time) time.Time { return t.AddDate(0, 0, -1) })
+	attachMovingAverage(days)
+
+	attachDeltas(months, func(t time.Time) time.Time { return t.AddDate(0, -1, 0) })
+	attachYearOverYear(months)
+
+	attachDeltas(rolling, func(t time.Time) time.Time { return t.AddDate(0, 0, -conf.RollingInterval) })
+
+	for _, table := range extraStats(conf) {
+		attachDeltas(table.Rows, table.Granularity.Prev)
+	}
+
+	for _, pl := range conf.Platforms {
+		pl.LastSubmission = pl.LastSubmission.In(conf.Loc())
+		pl.DayStats = trimRows(pl.DayStats, conf.NumDays)
+		pl.MonthsStats = trimRows(pl.MonthsStats, conf.NumMonths)
+		pl.RollingMonthsStats = trimRows(pl.RollingMonthsStats, conf.NumRollingMonths)
+		for i, extra := range pl.ExtraStats {
+			if i < len(conf.ExtraQueries) && conf.ExtraQueries[i].Limit > 0 {
+				extra.Rows = trimRows(extra.Rows, conf.ExtraQueries[i].Limit)
+			}
+		}
+	}
+}
+
+// withLookback extends the limit of the queries by one period, so the oldest returned period also gets a delta
+func withLookback(queries []scraper.StatsQuery) []scraper.StatsQuery {
+	out := make([]scraper.StatsQuery, len(queries))
+	for i, q := range queries {
+		if q.Limit > 0 {
+			q.Limit++
+		}
+		out[i] = q
+	}
+	return out
+}
+
+// trimRows keeps the n newest rows. Rows are sorted newest first
+func trimRows(rows []*scraper.StatsRow, n int) []*scraper.StatsRow {
+	if len(rows) > n {
+		return rows[:n]
+	}
+	return rows
+}
+
+// periodIndex looks up the aligned rows of a platform by period start.
+type periodIndex struct {
+	days []daysStruct
+
+	byTime map[int64]int
+	// Earliest period with data, per platform. Periods before it are outside the queried range
+	oldest []time.Time
+}
+
+func newPeriodIndex(days []daysStruct) *periodIndex {
+	idx := &periodIndex{days: days, byTime: make(map[int64]int, len(days))}
+	for i, day := range days {
+		idx.byTime[day.DayUTC.Unix()] = i
+		for p, row := range day.Platforms {
+			if len(idx.oldest) <= p {
+				idx.oldest = append(idx.oldest, make([]time.Time, p+1-len(idx.oldest))...)
+			}
+			if row != nil && (idx.oldest[p].IsZero() || day.DayUTC.Before(idx.oldest[p])) {
+				idx.oldest[p] = day.DayUTC
+			}
+		}
+	}
+	return idx
+}
+
+// get returns the row of platform p for the period starting at t. ok is false if the period is outside the queried range;
+// otherwise a nil row means there was no activity in that period.
+func (idx *periodIndex) get(p int, t time.Time) (row *scraper.StatsRow, ok bool) {
+	if p >= len(idx.oldest) || idx.oldest[p].IsZero() || t.Before(idx.oldest[p]) {
+		return nil, false
+	}
+	i, found := idx.byTime[t.Unix()]
+	if !found {
+		return nil, true
+	}
+	return idx.days[i].Platforms[p], true
+}
+
+// attachDeltas sets the change versus the period starting at prev(t) on every row
+func attachDeltas(days []daysStruct, prev func(time.Time) time.Time) {
+	idx := newPeriodIndex(days)
+	for _, day := range days {
+		for p, row := range day.Platforms {
+			if row == nil {
+				continue
+			}
+			if older, ok := idx.get(p, prev(day.DayUTC)); ok {
+				row.Delta = row.DeltaFrom(older)
+			}
+		}
+	}
+}
+
+func attachYearOverYear(days []daysStruct) {
+	idx := newPeriodIndex(days)
+	for _, day := range days {
+		for p, row := range day.Platforms {
+			if row == nil {
+				continue
+			}
+			if older, ok := idx.get(p, day.DayUTC.AddDate(-1, 0, 0)); ok {
+				row.YearOverYear = row.DeltaFrom(older)
+			}
+		}
+	}
+}
+
+const movingAvgDays = 7
+
+// attachMovingAverage sets the average submission count over the movingAvgDays days ending with each day,
+// for the days which have the whole window inside the queried range.
+func attachMovingAverage(days []daysStruct) {
+	n := movingAvgDays
+	idx := newPeriodIndex(days)
+	for _, day := range days {
+		for p, row := range day.Platforms {
+			if row == nil {
+				continue
+			}
+			if _, ok := idx.get(p, day.DayUTC.AddDate(0, 0, -(n-1))); !ok {
+				continue
+			}
+			var sum int
+			for i := 0; i < n; i++ {
+				if r, _ := idx.get(p, day.DayUTC.AddDate(0, 0, -i)); r != nil {
+					sum += r.NumSubmissions
+				}
+			}
+			avg := float64(sum) / float64(n)
+			row.MovingAvg7 = &avg
+		}
+	}
+}